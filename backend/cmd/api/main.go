@@ -1,8 +1,11 @@
 package main
 
 import (
+	"backend/internal/config"
 	"backend/internal/controller"
 	"backend/internal/database"
+	"backend/pkg/parse"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,19 +14,47 @@ import (
 )
 
 func main() {
-	if err := database.Connect(); err != nil {
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := flags.Load()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	store, err := database.Open(cfg)
+	if err != nil {
 		panic(err.Error())
 	}
 
+	// an in-memory store starts empty, so run the parse pipeline over the bill directories
+	if cfg.Store == "memory" {
+		fmt.Println("Parsing bills into memory...")
+		overrides, err := parse.LoadOverrides(cfg.Overrides)
+		if err != nil {
+			panic(err.Error())
+		}
+		report := parse.NewReport()
+		if err := parse.PopulateAll(store, cfg.BillDirs, overrides, cfg.Legislators, cfg.Edges, report); err != nil {
+			panic(err.Error())
+		}
+		report.PrintSummary()
+	}
+
+	// exports stream for as long as the collection takes, so only the other routes are cut off after 15 seconds
+	router := controller.Router(store)
+	handler := http.NewServeMux()
+	handler.Handle("/api/export/", router)
+	handler.Handle("/", http.TimeoutHandler(router, 15*time.Second, `{"error":"Request timed out"}`))
+
 	server := &http.Server{
-		Handler:      controller.Router(),
-		Addr:         "127.0.0.1:3000",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		Handler:     handler,
+		Addr:        cfg.Addr,
+		ReadTimeout: 15 * time.Second,
 	}
 
 	go server.ListenAndServe()
-	fmt.Println("API listening on port 3000...")
+	fmt.Printf("API listening on %s...\n", cfg.Addr)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -31,5 +62,5 @@ func main() {
 
 	fmt.Println("\nSIGTERM received...")
 
-	database.Disconnect()
+	store.Disconnect()
 }
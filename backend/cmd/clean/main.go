@@ -1,6 +1,7 @@
 package main
 
 import (
+	"backend/internal/config"
 	"backend/internal/database"
 	"flag"
 )
@@ -8,16 +9,24 @@ import (
 func main() {
 	dropBills := flag.Bool("b", false, "Drop bills")
 	dropMembers := flag.Bool("m", false, "Drop members")
-	dropCells := flag.Bool("c", false, "Drop cells")
+	dropCells := flag.Bool("c", false, "Drop cells and directed edges")
 	dropSubjects := flag.Bool("s", false, "Drop subjects")
+	dropSearch := flag.Bool("t", false, "Drop the search index")
+	flags := config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	if err := database.Connect(); err != nil {
+	cfg, err := flags.Load()
+	if err != nil {
 		panic(err.Error())
 	}
-	defer database.Disconnect()
 
-	if err := database.Clean(*dropBills, *dropMembers, *dropCells, *dropSubjects); err != nil {
+	store, err := database.Open(cfg)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer store.Disconnect()
+
+	if err := store.Clean(*dropBills, *dropMembers, *dropCells, *dropSubjects, *dropSearch); err != nil {
 		panic(err.Error())
 	}
 
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/controller"
+	"backend/internal/database"
+	"backend/pkg/export"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func main() {
+	collection := flag.String("collection", "bills", "Collection to export ("+strings.Join(export.Collections, ", ")+")")
+	format := flag.String("format", export.CSV, "Export format ("+strings.Join(export.Formats, ", ")+")")
+	outPath := flag.String("o", "", "Path of the export, standard output when empty")
+	query := flag.String("query", "", "Filter params as accepted by the API (e.g. congress=116&bipartisan=true)")
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// the store reports connecting and disconnecting on standard output, which may carry the export
+	var out io.Writer = os.Stdout
+	os.Stdout = os.Stderr
+
+	cfg, err := flags.Load()
+	if err != nil {
+		panic("Config error: " + err.Error())
+	}
+
+	store, err := database.Open(cfg)
+	if err != nil {
+		panic("Store open error: " + err.Error())
+	}
+	defer store.Disconnect()
+
+	values, err := url.ParseQuery(*query)
+	if err != nil {
+		panic("Query error: " + err.Error())
+	}
+	filter, err := controller.ExportFilter(store, *collection, values)
+	if err != nil {
+		panic("Filter error: " + err.Error())
+	}
+
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			panic("Output error: " + err.Error())
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+	n, err := export.Export(store, *collection, *format, filter, buffered)
+	if err != nil {
+		panic("Export error: " + err.Error())
+	}
+	if err := buffered.Flush(); err != nil {
+		panic("Output error: " + err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d %s as %s\n", n, *collection, *format)
+}
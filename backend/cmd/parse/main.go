@@ -1,6 +1,7 @@
 package main
 
 import (
+	"backend/internal/config"
 	"backend/internal/database"
 	"backend/pkg/parse"
 	"flag"
@@ -12,23 +13,56 @@ func main() {
 	populateMembers := flag.Bool("m", false, "Populate members")
 	populateCells := flag.Bool("c", false, "Populate cells and member counts")
 	populateSubjects := flag.Bool("s", false, "Populate policy areas and subjects")
+	populateLegislators := flag.Bool("l", false, "Import legislator biographical data into members")
+	populateMetrics := flag.Bool("g", false, "Compute member network metrics")
+	populateCommunities := flag.Bool("k", false, "Detect member communities")
+	populateSearch := flag.Bool("t", false, "Build the bill search index")
+	reportPath := flag.String("r", "parse-report.json", "Path of the JSON error report")
+	flags := config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	if err := database.Connect(); err != nil {
-		panic("Mongo connect error: " + err.Error())
+	cfg, err := flags.Load()
+	if err != nil {
+		panic("Config error: " + err.Error())
 	}
-	defer database.Disconnect()
 
-	if !*populateBills && !*populateMembers && !*populateCells && !*populateSubjects {
+	store, err := database.Open(cfg)
+	if err != nil {
+		panic("Store open error: " + err.Error())
+	}
+	defer store.Disconnect()
+
+	if !*populateBills && !*populateMembers && !*populateCells && !*populateSubjects && !*populateLegislators && !*populateMetrics && !*populateCommunities && !*populateSearch {
 		*populateBills = true
 		*populateMembers = true
 		*populateCells = true
 		*populateSubjects = true
+		*populateLegislators = true
+		*populateMetrics = true
+		*populateCommunities = true
+		*populateSearch = true
+	}
+
+	overrides, err := parse.LoadOverrides(cfg.Overrides)
+	if err != nil {
+		panic("Overrides error: " + err.Error())
 	}
 
+	report := parse.NewReport()
+	defer func() {
+		if report.Summary()["identity"] > 0 {
+			fmt.Println("Ambiguous member identities:")
+			report.PrintIssues("identity")
+		}
+		report.PrintSummary()
+		if err := report.WriteJSON(*reportPath); err != nil {
+			fmt.Println("Unable to write error report: " + err.Error())
+		}
+	}()
+
 	if *populateBills {
 		fmt.Println("Populating bills collection...")
-		err := parse.PopulateBills()
+		err := parse.PopulateBills(store, cfg.BillDirs, report)
 		if err != nil {
 			panic("Populate bills error: " + err.Error())
 		}
@@ -36,30 +70,65 @@ func main() {
 
 	if *populateMembers {
 		fmt.Println("Populating members collection...")
-		err := parse.PopulateMembers()
+		err := parse.PopulateMembers(store, overrides, report)
 		if err != nil {
 			panic("Populate members error: " + err.Error())
 		}
 	}
 
+	if *populateLegislators {
+		fmt.Println("Importing legislator biographical data...")
+		err := parse.PopulateLegislators(store, cfg.Legislators, report)
+		if err != nil {
+			panic("Populate legislators error: " + err.Error())
+		}
+	}
+
+	// metrics and communities are recomputed for every congress unless the cells stage narrows them
+	var touched parse.Touched
 	if *populateCells {
 		fmt.Println("Populating cells collection...")
-		err := parse.PopulateCells()
+		var err error
+		touched, err = parse.PopulateCells(store, overrides, cfg.Edges, report)
 		if err != nil {
 			panic("Populate cells error: " + err.Error())
 		}
 		fmt.Println("Populating member counts...")
-		err = parse.PopulateCounts()
+		err = parse.PopulateCounts(store, touched, report)
 		if err != nil {
 			panic("Populate counts error: " + err.Error())
 		}
 	}
 
+	if *populateMetrics {
+		fmt.Println("Computing member network metrics...")
+		err := parse.PopulateMetrics(store, touched, cfg.Edges, report)
+		if err != nil {
+			panic("Populate metrics error: " + err.Error())
+		}
+	}
+
+	if *populateCommunities {
+		fmt.Println("Detecting member communities...")
+		err := parse.PopulateCommunities(store, touched, report)
+		if err != nil {
+			panic("Populate communities error: " + err.Error())
+		}
+	}
+
 	if *populateSubjects {
 		fmt.Println("Populating policy areas and subjects collection...")
-		err := parse.PopulateSubjects()
+		err := parse.PopulateSubjects(store, report)
 		if err != nil {
 			panic("Populate subjects error: " + err.Error())
 		}
 	}
+
+	if *populateSearch {
+		fmt.Println("Building bill search index...")
+		err := parse.PopulateSearch(store, report)
+		if err != nil {
+			panic("Populate search error: " + err.Error())
+		}
+	}
 }
@@ -3,6 +3,9 @@ module backend
 go 1.15
 
 require (
+	github.com/blevesearch/go-porterstemmer v1.0.3
 	github.com/gorilla/mux v1.8.0
+	go.etcd.io/bbolt v1.3.5
 	go.mongodb.org/mongo-driver v1.4.3
+	gopkg.in/yaml.v2 v2.2.8
 )
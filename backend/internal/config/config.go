@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Config holds the settings shared by the api, parse and clean commands
+type Config struct {
+	Store       string   `json:"store"`
+	MongoURI    string   `json:"mongoURI"`
+	Database    string   `json:"database"`
+	Path        string   `json:"path"`
+	BillDirs    []string `json:"billDirs"`
+	Overrides   string   `json:"overrides"`
+	Legislators string   `json:"legislators"`
+	Edges       string   `json:"edges"`
+	Addr        string   `json:"addr"`
+}
+
+// Default returns the settings used when nothing else is supplied
+func Default() Config {
+	return Config{
+		Store:       "mongo",
+		MongoURI:    "mongodb://localhost:27017",
+		Database:    "cosign",
+		Path:        "cosign.db",
+		BillDirs:    []string{"../../bills"},
+		Overrides:   "../../identity-overrides.json",
+		Legislators: "../../congress-legislators",
+		Edges:       "cross",
+		Addr:        "127.0.0.1:3000",
+	}
+}
+
+// Environment variables read by Load
+const (
+	EnvConfig      = "COSIGN_CONFIG"
+	EnvStore       = "COSIGN_STORE"
+	EnvMongoURI    = "COSIGN_MONGO_URI"
+	EnvDatabase    = "COSIGN_DB"
+	EnvPath        = "COSIGN_PATH"
+	EnvBillDirs    = "COSIGN_BILLS"
+	EnvOverrides   = "COSIGN_OVERRIDES"
+	EnvLegislators = "COSIGN_LEGISLATORS"
+	EnvEdges       = "COSIGN_EDGES"
+	EnvAddr        = "COSIGN_ADDR"
+)
+
+// Flags holds the shared command line flags registered on a flag set
+type Flags struct {
+	fs          *flag.FlagSet
+	path        *string
+	store       *string
+	mongoURI    *string
+	database    *string
+	dbPath      *string
+	billDirs    *string
+	overrides   *string
+	legislators *string
+	edges       *string
+	addr        *string
+}
+
+// RegisterFlags registers the shared flags on fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	d := Default()
+	return &Flags{
+		fs:          fs,
+		path:        fs.String("config", "", "Path of a JSON config file (env "+EnvConfig+")"),
+		store:       fs.String("store", d.Store, "Storage backend, mongo, bolt or memory (env "+EnvStore+")"),
+		mongoURI:    fs.String("mongo-uri", d.MongoURI, "Mongo connection URI (env "+EnvMongoURI+")"),
+		database:    fs.String("db", d.Database, "Mongo database name (env "+EnvDatabase+")"),
+		dbPath:      fs.String("path", d.Path, "Database file used by the bolt store (env "+EnvPath+")"),
+		billDirs:    fs.String("bills", strings.Join(d.BillDirs, ","), "Comma separated directories of BILLSTATUS XML, one per congress (env "+EnvBillDirs+")"),
+		overrides:   fs.String("overrides", d.Overrides, "Path of the JSON member identity overrides (env "+EnvOverrides+")"),
+		legislators: fs.String("legislators", d.Legislators, "Directory of congress-legislators YAML or JSON files (env "+EnvLegislators+")"),
+		edges:       fs.String("edges", d.Edges, "Cell edge policy, cross, same or all (env "+EnvEdges+")"),
+		addr:        fs.String("addr", d.Addr, "API listen address (env "+EnvAddr+")"),
+	}
+}
+
+// Load resolves the configuration once the flag set has been parsed
+// Precedence from lowest to highest: defaults, config file, environment variables, explicitly set flags
+func (f *Flags) Load() (Config, error) {
+	c := Default()
+
+	path := *f.path
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	if path != "" {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		if err := json.Unmarshal(bs, &c); err != nil {
+			return c, err
+		}
+	}
+
+	if v := os.Getenv(EnvStore); v != "" {
+		c.Store = v
+	}
+	if v := os.Getenv(EnvMongoURI); v != "" {
+		c.MongoURI = v
+	}
+	if v := os.Getenv(EnvDatabase); v != "" {
+		c.Database = v
+	}
+	if v := os.Getenv(EnvPath); v != "" {
+		c.Path = v
+	}
+	if v := os.Getenv(EnvBillDirs); v != "" {
+		c.BillDirs = strings.Split(v, ",")
+	}
+	if v := os.Getenv(EnvOverrides); v != "" {
+		c.Overrides = v
+	}
+	if v := os.Getenv(EnvLegislators); v != "" {
+		c.Legislators = v
+	}
+	if v := os.Getenv(EnvEdges); v != "" {
+		c.Edges = v
+	}
+	if v := os.Getenv(EnvAddr); v != "" {
+		c.Addr = v
+	}
+
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "store":
+			c.Store = *f.store
+		case "mongo-uri":
+			c.MongoURI = *f.mongoURI
+		case "db":
+			c.Database = *f.database
+		case "path":
+			c.Path = *f.dbPath
+		case "bills":
+			c.BillDirs = strings.Split(*f.billDirs, ",")
+		case "overrides":
+			c.Overrides = *f.overrides
+		case "legislators":
+			c.Legislators = *f.legislators
+		case "edges":
+			c.Edges = *f.edges
+		case "addr":
+			c.Addr = *f.addr
+		}
+	})
+
+	return c, nil
+}
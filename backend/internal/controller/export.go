@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"backend/internal/database"
+	"backend/pkg/export"
+	"backend/pkg/search"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExportFilter translates the query params of a collection's listing into an export filter
+// Unlike the listings, every congress is exported when the congress param is absent and cells need no subject or window
+// bills: the bill query params and q, members: chamber, party, state and termStart,
+// cells: chamber, edges, subjects, from and to, subjects: congress only
+func ExportFilter(store database.Store, collection string, query url.Values) (export.Filter, error) {
+	params := url.Values{"congress": {"all"}}
+	for name, values := range query {
+		params[name] = values
+	}
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{RawQuery: params.Encode()}}
+	filter := export.Filter{Query: bson.M{}}
+	if params.Get("congress") != "all" {
+		if _, err := ParseCongress(r); err != nil {
+			return filter, fmt.Errorf("incorrect congress param: %v", err)
+		}
+	}
+	congress, err := CongressOrAll(r, store)
+	if err == errNoCongresses {
+		return filter, fmt.Errorf("incorrect congress param: %v", err)
+	} else if err != nil {
+		return filter, storeError{err}
+	}
+	if congress != 0 {
+		filter.Query["congress"] = congress
+		// the resolved congress spares billFilter a second lookup of the most recent one
+		params.Set("congress", strconv.Itoa(congress))
+		r = &http.Request{Method: http.MethodGet, URL: &url.URL{RawQuery: params.Encode()}}
+	}
+	switch collection {
+	case "bills":
+		filter.Query, err = billFilter(r, store)
+		if err != nil {
+			return filter, err
+		}
+		if s := r.FormValue("q"); s != "" {
+			filter.Query, err = searchFilter(store, s, congress, filter.Query)
+			return filter, err
+		}
+	case "members":
+		if err := addChamberFilter(r, filter.Query); err != nil {
+			return filter, err
+		}
+		return filter, addMemberFilters(r, filter.Query)
+	case "cells":
+		edges, err := ParseEdges(r)
+		if err != nil {
+			return filter, err
+		}
+		filter.Query["edges"] = bson.M{"$in": edges}
+		if s := r.FormValue("subjects"); s != "" {
+			filter.Subjects = strings.Split(s, ",")
+			filter.Query["subjects"] = bson.M{"$in": filter.Subjects}
+		}
+		if err := addChamberFilter(r, filter.Query); err != nil {
+			return filter, err
+		}
+		filter.Window, err = ParseWindow(r)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect from or to param: %v", err)
+		}
+	case "subjects":
+	default:
+		return filter, fmt.Errorf("unknown collection %q", collection)
+	}
+	return filter, nil
+}
+
+// searchFilter narrows a bill filter to the bills matching a search query, in the supplied congress or all of them
+func searchFilter(store database.Store, s string, congress int, filter bson.M) (bson.M, error) {
+	q, err := search.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	congresses := []int{congress}
+	if congress == 0 {
+		if congresses, err = store.GetCongresses(); err != nil {
+			return nil, storeError{err}
+		}
+	}
+	hits, err := search.Search(store, q, congresses)
+	if err != nil {
+		return nil, storeError{err}
+	}
+	return bson.M{"$and": []bson.M{filter, search.Filter(hits)}}, nil
+}
+
+// storeError marks an ExportFilter error raised by the store rather than by the params
+type storeError struct {
+	error
+}
+
+// exportWriter records whether any of an export has been sent
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// getExport streams a collection's documents matching the listing's query params as CSV (the default),
+// NDJSON or Parquet, following the format param
+// Errors after the first bytes are sent can only truncate the response, so they are logged
+func (h *handlers) getExport(w http.ResponseWriter, r *http.Request) {
+	collection := mux.Vars(r)["collection"]
+	format := r.FormValue("format")
+	if format == "" {
+		format = export.CSV
+	}
+	if _, ok := export.ContentTypes[format]; !ok {
+		WriteError(w, http.StatusBadRequest, "Incorrect format param", fmt.Sprintf("format must be one of %s", strings.Join(export.Formats, ", ")))
+		return
+	}
+	query := r.URL.Query()
+	query.Del("format")
+	filter, err := ExportFilter(h.store, collection, query)
+	if _, ok := err.(storeError); ok {
+		WriteError(w, http.StatusInternalServerError, "Unable to filter export", err.Error())
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect export params", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", export.ContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", collection+"."+format))
+	ew := &exportWriter{ResponseWriter: w}
+	n, err := export.Export(h.store, collection, format, filter, ew)
+	if err != nil && !ew.started {
+		w.Header().Del("Content-Disposition")
+		WriteError(w, http.StatusInternalServerError, "Unable to export "+collection, err.Error())
+	} else if err != nil {
+		log.Printf("export of %s failed after %d rows: %v", collection, n, err)
+	}
+}
@@ -2,182 +2,655 @@ package controller
 
 import (
 	"backend/internal/database"
+	"backend/pkg/search"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func getBillsByNumber(w http.ResponseWriter, r *http.Request) {
-	numbersString := r.FormValue("billNumbers")
+var billIDPattern = regexp.MustCompile(`^[a-z]+[0-9]+$`)
+
+// billNumbersFilter matches a comma separated list of bill numbers (any type)
+// and bill IDs (e.g. hr1, sres20)
+func billNumbersFilter(s string) (bson.M, error) {
 	numbers := []int{}
-	for _, s := range strings.Split(numbersString, ",") {
-		n, err := strconv.Atoi(s)
-		if err != nil {
-			WriteError(w, http.StatusBadRequest, "Incorrect numbers param", "")
-			return
+	ids := []string{}
+	for _, token := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(token); err == nil {
+			numbers = append(numbers, n)
+			continue
 		}
-		numbers = append(numbers, n)
+		id := strings.ToLower(token)
+		if !billIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("%q is neither a bill number nor a bill ID", token)
+		}
+		ids = append(ids, id)
 	}
-	filter := bson.M{
-		"number": bson.M{
-			"$in": numbers,
+	return bson.M{
+		"$or": []bson.M{
+			{"number": bson.M{"$in": numbers}},
+			{"id": bson.M{"$in": ids}},
 		},
+	}, nil
+}
+
+// addTypeFilter restricts a bill filter to the comma separated types param (e.g. hr,hjres)
+func addTypeFilter(r *http.Request, filter bson.M) {
+	if types := r.FormValue("type"); types != "" {
+		filter["type"] = bson.M{
+			"$in": strings.Split(strings.ToLower(types), ","),
+		}
+	}
+}
+
+// addChamberFilter restricts a member, cell or edge filter to the chamber param when present
+func addChamberFilter(r *http.Request, filter bson.M) error {
+	chamber := strings.ToLower(r.FormValue("chamber"))
+	switch chamber {
+	case "":
+	case database.House, database.Senate:
+		filter["chamber"] = chamber
+	default:
+		return fmt.Errorf("unknown chamber %q", chamber)
+	}
+	return nil
+}
+
+// addMemberFilters narrows members by the optional party (e.g. D), state (e.g. CA)
+// and termStart (YYYY-MM-DD, matching members who began a term on or after the date) params
+func addMemberFilters(r *http.Request, filter bson.M) error {
+	if party := r.FormValue("party"); party != "" {
+		filter["parties"] = strings.ToUpper(party)
+	}
+	if state := r.FormValue("state"); state != "" {
+		filter["state"] = strings.ToUpper(state)
 	}
-	bills, err := database.GetBills(filter)
+	if s := r.FormValue("termStart"); s != "" {
+		date, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return err
+		}
+		filter["terms.start"] = bson.M{"$gte": date}
+	}
+	return nil
+}
+
+// pageMeta describes the position of a page in a listing
+// NextCursor is omitted on the last page
+type pageMeta struct {
+	Total      int64  `json:"total"`
+	Offset     int64  `json:"offset"`
+	Limit      int64  `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// billsPage is the envelope of a bill listing
+type billsPage struct {
+	Bills interface{} `json:"bills"`
+	pageMeta
+}
+
+func (p billsPage) envelope() (interface{}, interface{}) {
+	return p.Bills, p.pageMeta
+}
+
+// newBillsPage wraps the n listed items of a page, reduced to the page's fields when it selects any
+func newBillsPage(items interface{}, n int, total int64, page database.Page, keep ...string) (billsPage, error) {
+	body := billsPage{Bills: items, pageMeta: pageMeta{Total: total, Offset: page.Offset, Limit: page.Limit}}
+	if next := page.Offset + int64(n); next < total {
+		body.NextCursor = EncodeCursor(next)
+	}
+	if len(page.Fields) > 0 {
+		selected, err := selectFields(items, append(append([]string{}, page.Fields...), keep...))
+		if err != nil {
+			return body, err
+		}
+		body.Bills = selected
+	}
+	return body, nil
+}
+
+// writeBillsPage responds with the page of bills matching filter selected by the paging params
+func (h *handlers) writeBillsPage(w http.ResponseWriter, r *http.Request, filter bson.M) {
+	page, err := ParseBillPage(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect paging params", err.Error())
+		return
+	}
+	bills, total, err := h.store.GetBillsPage(filter, page)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Unable to get bills", "")
 		return
 	}
-	WriteResponse(w, bills)
+	body, err := newBillsPage(bills, len(bills), total, page)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Unable to select bill fields", err.Error())
+		return
+	}
+	WriteResponse(w, body)
 }
 
-func getBillsByTitle(w http.ResponseWriter, r *http.Request) {
-	query := r.FormValue("query")
-	bipartisan := r.FormValue("bipartisan")
-	strBillNumbers := r.FormValue("billNumbers")
+// selectFields reduces each item of a slice to the supplied JSON fields
+func selectFields(items interface{}, fields []string) ([]map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	all := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+	selected := make([]map[string]json.RawMessage, len(all))
+	for i := range all {
+		selected[i] = map[string]json.RawMessage{}
+		for _, field := range fields {
+			selected[i][field] = all[i][field]
+		}
+	}
+	return selected, nil
+}
 
-	filter := bson.M{}
+// searchHit is a bill of a search listing with its relevance score and highlighted matches
+type searchHit struct {
+	database.Bill
+	Relevance  float64           `json:"relevance"`
+	Highlights search.Highlights `json:"highlights"`
+}
 
-	if query != "*" {
-		filter["titleLower"] = bson.M{"$regex": strings.ToLower(query)}
-	}
+// searchFields are always loaded for search hits, to identify and highlight them
+var searchFields = []string{"congress", "id", "title", "summary", "subjects"}
 
-	if bipartisan == "true" {
-		filter["multiParty"] = true
+// searchBills ranks the bills matching the q param by relevance
+// The bill query params narrow the bills searched, and the paging params apply as on other bill
+// listings; an explicit sort orders the hits by bill fields rather than score
+func (h *handlers) searchBills(w http.ResponseWriter, r *http.Request) {
+	q, err := search.Parse(r.FormValue("q"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect q param", err.Error())
+		return
+	}
+	page, err := ParseBillPage(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect paging params", err.Error())
+		return
+	}
+	congress, err := CongressOrAll(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
 	}
+	congresses := []int{congress}
+	if congress == 0 {
+		congresses, err = h.store.GetCongresses()
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Unable to get congresses", "")
+		return
+	}
+	// hits are limited to the congresses searched, so the filter only needs the remaining params
+	filter, err := billFilter(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect bill query params", err.Error())
+		return
+	}
+	delete(filter, "congress")
 
-	if len(strBillNumbers) > 0 {
-		// convert from string to int
-		billNumbers := []int{}
-		for _, s := range strings.Split(strBillNumbers, ",") {
-			n, err := strconv.Atoi(s)
+	hits, err := search.Search(h.store, q, congresses)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Unable to search bills", err.Error())
+		return
+	}
+	load := database.Page{}
+	if len(page.Fields) > 0 {
+		load.Fields = append(append([]string{}, page.Fields...), searchFields...)
+	}
+	var bills []database.Bill
+	var total int64
+	if r.FormValue("sort") != "" {
+		sorted := page
+		sorted.Fields = load.Fields
+		bills, total, err = h.store.GetBillsPage(bson.M{"$and": []bson.M{filter, search.Filter(hits)}}, sorted)
+	} else {
+		if len(filter) > 0 {
+			hits, err = h.filterHits(hits, filter)
 			if err != nil {
-				WriteError(w, http.StatusBadRequest, "Bill numbers much be integers", "")
+				WriteError(w, http.StatusInternalServerError, "Unable to get bills", "")
 				return
 			}
-			billNumbers = append(billNumbers, n)
 		}
-		filter["number"] = bson.M{
-			"$in": billNumbers,
+		total = int64(len(hits))
+		from, to := page.Offset, page.Offset+page.Limit
+		if from > total {
+			from = total
+		}
+		if to > total {
+			to = total
 		}
+		hits = hits[from:to]
+		bills, _, err = h.store.GetBillsPage(search.Filter(hits), load)
 	}
-
-	bills, err := database.GetBills(filter)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Unable to get bills", "")
 		return
 	}
-	WriteResponse(w, bills)
-}
 
-func getBillsBySubjects(w http.ResponseWriter, r *http.Request) {
-	subjectsQuery := r.FormValue("subjects")
-	if subjectsQuery == "" {
-		WriteError(w, http.StatusBadRequest, "Missing subjects", "")
-		return
+	ranks := map[string]int{}
+	for i, hit := range hits {
+		ranks[fmt.Sprintf("%d/%s", hit.Congress, hit.BillID)] = i
 	}
-	subjects := strings.Split(subjectsQuery, ",")
-	filter := bson.M{
-		"subject": bson.M{
-			"$in": subjects,
-		},
+	results := make([]searchHit, len(bills))
+	for i, b := range bills {
+		rank := ranks[fmt.Sprintf("%d/%s", b.Congress, b.ID)]
+		results[i] = searchHit{Bill: b, Relevance: hits[rank].Score, Highlights: search.Highlight(b, q)}
+	}
+	if r.FormValue("sort") == "" {
+		sort.Slice(results, func(i, j int) bool {
+			return ranks[fmt.Sprintf("%d/%s", results[i].Congress, results[i].ID)] < ranks[fmt.Sprintf("%d/%s", results[j].Congress, results[j].ID)]
+		})
 	}
-	subjectDocuments, err := database.GetSubjects(filter)
+	body, err := newBillsPage(results, len(results), total, page, "relevance", "highlights")
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "Error retreiving subjects", "")
+		WriteError(w, http.StatusInternalServerError, "Unable to select bill fields", err.Error())
 		return
 	}
-	billNumbers := []int{}
-	for _, subjectDocument := range subjectDocuments {
-		billNumbers = append(billNumbers, subjectDocument.BillNumbers...)
+	WriteResponse(w, body)
+}
+
+// filterHits keeps the hits whose bills match filter
+func (h *handlers) filterHits(hits []search.Hit, filter bson.M) ([]search.Hit, error) {
+	bills, _, err := h.store.GetBillsPage(bson.M{"$and": []bson.M{filter, search.Filter(hits)}}, database.Page{Fields: []string{"congress", "id"}})
+	if err != nil {
+		return nil, err
 	}
-	filter = bson.M{
-		"number": bson.M{
-			"$in": billNumbers,
-		},
+	kept := map[string]bool{}
+	for _, b := range bills {
+		kept[fmt.Sprintf("%d/%s", b.Congress, b.ID)] = true
+	}
+	filtered := []search.Hit{}
+	for _, hit := range hits {
+		if kept[fmt.Sprintf("%d/%s", hit.Congress, hit.BillID)] {
+			filtered = append(filtered, hit)
+		}
+	}
+	return filtered, nil
+}
+
+// partyCounts maps party letters to the bill fields counting their sponsors and cosponsors
+var partyCounts = map[string]string{"D": "numDems", "R": "numReps", "I": "numInds", "L": "numLibs"}
+
+// billFilter translates the optional bill query params into a single filter: billNumbers, query (a title
+// substring, * for all), subjects, policyArea, sponsor and cosponsor (bioguide IDs), each a comma separated list,
+// bipartisan, parties (e.g. D,R, each of which must appear), minScore and maxScore, from and to (introduced
+// dates, YYYY-MM-DD), congress (the most recent when absent, all for every congress) and type
+func billFilter(r *http.Request, store database.Store) (bson.M, error) {
+	filter := bson.M{}
+	if s := r.FormValue("billNumbers"); s != "" {
+		numbersFilter, err := billNumbersFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filter["$or"] = numbersFilter["$or"]
+	}
+	if query := r.FormValue("query"); query != "" && query != "*" {
+		filter["titleLower"] = bson.M{"$regex": regexp.QuoteMeta(strings.ToLower(query))}
 	}
-	bipartisan := r.FormValue("bipartisan")
-	if bipartisan == "true" {
+	if s := r.FormValue("subjects"); s != "" {
+		filter["subjects"] = bson.M{"$in": strings.Split(s, ",")}
+	}
+	if s := r.FormValue("policyArea"); s != "" {
+		filter["policyArea"] = bson.M{"$in": strings.Split(s, ",")}
+	}
+	if s := r.FormValue("sponsor"); s != "" {
+		filter["sponsors.bioguideId"] = bson.M{"$in": strings.Split(strings.ToUpper(s), ",")}
+	}
+	if s := r.FormValue("cosponsor"); s != "" {
+		filter["cosponsors"] = bson.M{"$elemMatch": bson.M{
+			"bioguideId":    bson.M{"$in": strings.Split(strings.ToUpper(s), ",")},
+			"withdrawnDate": bson.M{"$exists": false},
+		}}
+	}
+	switch bipartisan := r.FormValue("bipartisan"); bipartisan {
+	case "", "false":
+	case "true":
 		filter["multiParty"] = true
+	default:
+		return nil, fmt.Errorf("bipartisan must be true or false, not %q", bipartisan)
+	}
+	if s := r.FormValue("parties"); s != "" {
+		for _, party := range strings.Split(strings.ToUpper(s), ",") {
+			field, ok := partyCounts[party]
+			if !ok {
+				return nil, fmt.Errorf("unknown party %q", party)
+			}
+			filter[field] = bson.M{"$gt": 0}
+		}
 	}
-	bills, err := database.GetBills(filter)
+	score := bson.M{}
+	for param, op := range map[string]string{"minScore": "$gte", "maxScore": "$lte"} {
+		if s := r.FormValue(param); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", param)
+			}
+			score[op] = n
+		}
+	}
+	if len(score) > 0 {
+		filter["score"] = score
+	}
+	window, err := ParseWindow(r)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, "Error retreiving bills", "")
+		return nil, err
+	}
+	introduced := bson.M{}
+	if !window.From.IsZero() {
+		introduced["$gte"] = window.From
+	}
+	if !window.To.IsZero() {
+		introduced["$lte"] = window.To
+	}
+	if len(introduced) > 0 {
+		filter["introduced"] = introduced
+	}
+	congress, err := CongressOrAll(r, store)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect congress param: %v", err)
+	}
+	if congress != 0 {
+		filter["congress"] = congress
+	}
+	addTypeFilter(r, filter)
+	return filter, nil
+}
+
+// getBills lists the bills matching the bill query params, ranked by relevance when the q param is present
+// /api/bills/number, /api/bills/title, /api/bills/subject and /api/bills/search are aliases
+func (h *handlers) getBills(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("q") != "" {
+		h.searchBills(w, r)
 		return
 	}
-	WriteResponse(w, bills)
+	filter, err := billFilter(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect bill query params", err.Error())
+		return
+	}
+	h.writeBillsPage(w, r, filter)
+}
+
+// memberList pairs the members of a listing with a map of them by bioguide ID
+// /api/v1 returns only the list
+type memberList struct {
+	Members   []database.Member          `json:"members"`
+	MemberMap map[string]database.Member `json:"memberMap"`
 }
 
-func getMembers(w http.ResponseWriter, r *http.Request) {
-	members, memberMap, err := database.GetMembers(bson.M{})
+func (l memberList) envelope() (interface{}, interface{}) {
+	return l.Members, nil
+}
+
+func (h *handlers) getMembers(w http.ResponseWriter, r *http.Request) {
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	filter := bson.M{"congress": congress}
+	if err := addChamberFilter(r, filter); err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect chamber param", err.Error())
+		return
+	}
+	if err := addMemberFilters(r, filter); err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect member filter param", err.Error())
+		return
+	}
+	members, memberMap, err := h.store.GetMembers(filter)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Error retrieving members", "")
 		return
 	}
-	payload := map[string]interface{}{
-		"members":   members,
-		"memberMap": memberMap,
+	WriteResponse(w, memberList{Members: members, MemberMap: memberMap})
+}
+
+func (h *handlers) getMemberMetrics(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	// members are addressed by bioguide ID or by the numeric ID derived from it
+	filter := bson.M{"congress": congress, "bioguideId": strings.ToUpper(id)}
+	if n, err := strconv.Atoi(id); err == nil {
+		filter = bson.M{"congress": congress, "id": n}
 	}
-	WriteResponse(w, payload)
+	members, _, err := h.store.GetMembers(filter)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error retrieving members", err.Error())
+		return
+	}
+	if len(members) == 0 {
+		WriteError(w, http.StatusNotFound, "Unable to find member", "")
+		return
+	}
+	m := members[0]
+	WriteResponse(w, map[string]interface{}{
+		"congress":   m.Congress,
+		"bioguideId": m.BioguideID,
+		"id":         m.ID,
+		"name":       m.Name,
+		"metrics":    m.Metrics,
+	})
 }
 
-func getCell(w http.ResponseWriter, r *http.Request) {
+func (h *handlers) getCell(w http.ResponseWriter, r *http.Request) {
 	position, found := mux.Vars(r)["position"]
 	if !found {
 		WriteError(w, http.StatusBadRequest, "Missing position paramater", "")
 		return
 	}
-	cell, err := database.GetCell(bson.M{"position": position})
-	if err == mongo.ErrNoDocuments {
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	window, err := ParseWindow(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect from or to param", err.Error())
+		return
+	}
+	edges, err := ParseEdges(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect edges param", err.Error())
+		return
+	}
+	weight, err := ParseWeight(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect weight param", err.Error())
+		return
+	}
+	filter := bson.M{
+		"congress": congress,
+		"position": position,
+		"edges":    bson.M{"$in": edges},
+	}
+	cell, err := h.store.GetCell(filter, window)
+	if err == database.ErrNoDocuments {
 		WriteResponse(w, database.Cell{Bills: []database.Bill{}})
 		return
 	} else if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Error retrieving cell data", err.Error())
 		return
 	}
+	cell.SetWeight(weight)
 	WriteResponse(w, cell)
 }
 
-func getCells(w http.ResponseWriter, r *http.Request) {
-	subjectsStr, hasSubjects := mux.Vars(r)["subjects"]
+func (h *handlers) getCells(w http.ResponseWriter, r *http.Request) {
+	subjectsStr := r.FormValue("subjects")
 
-	if !hasSubjects || subjectsStr == "" {
-		WriteError(w, http.StatusBadRequest, "Missing subject", "")
+	window, err := ParseWindow(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect from or to param", err.Error())
 		return
 	}
 
-	subjects := strings.Split(subjectsStr, ",")
+	// the full matrix is only served when bounded by a window
+	if subjectsStr == "" && window.IsZero() {
+		WriteError(w, http.StatusBadRequest, "Missing subject or window", "")
+		return
+	}
+
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+
+	edges, err := ParseEdges(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect edges param", err.Error())
+		return
+	}
+	weight, err := ParseWeight(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect weight param", err.Error())
+		return
+	}
 
 	filter := bson.M{
-		"subjects": bson.M{
+		"edges": bson.M{"$in": edges},
+	}
+	var subjects []string
+	if subjectsStr != "" {
+		subjects = strings.Split(subjectsStr, ",")
+		filter["subjects"] = bson.M{
 			"$in": subjects,
-		},
+		}
+	}
+	if err := addChamberFilter(r, filter); err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect chamber param", err.Error())
+		return
 	}
 
-	cells, err := database.GetCells(filter, subjects)
+	cells, err := h.store.GetCells(congress, filter, subjects, window)
 
-	if err == mongo.ErrNoDocuments {
+	if err == database.ErrNoDocuments {
 		WriteError(w, http.StatusNotFound, "Unable to find any documents", "")
 		return
 	} else if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Error retrieving cell data", err.Error())
 		return
 	}
+	for i := range cells {
+		cells[i].SetWeight(weight)
+	}
 
 	WriteResponse(w, cells)
 }
 
-func getSubjects(w http.ResponseWriter, r *http.Request) {
-	policyAreas, err := database.GetPolicyAreas()
+// addEdgeFilters narrows directed edges by the optional source and target params, each a bioguide ID
+func addEdgeFilters(r *http.Request, filter bson.M) {
+	if source := r.FormValue("source"); source != "" {
+		filter["source"] = strings.ToUpper(source)
+	}
+	if target := r.FormValue("target"); target != "" {
+		filter["target"] = strings.ToUpper(target)
+	}
+}
+
+func (h *handlers) getDirectedEdge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	window, err := ParseWindow(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect from or to param", err.Error())
+		return
+	}
+	filter := bson.M{
+		"congress": congress,
+		"source":   strings.ToUpper(vars["source"]),
+		"target":   strings.ToUpper(vars["target"]),
+	}
+	edge, err := h.store.GetEdge(filter, window)
+	if err == database.ErrNoDocuments {
+		WriteResponse(w, database.Edge{Bills: []database.Bill{}})
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error retrieving edge data", err.Error())
+		return
+	}
+	WriteResponse(w, edge)
+}
+
+func (h *handlers) getDirectedEdges(w http.ResponseWriter, r *http.Request) {
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	window, err := ParseWindow(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect from or to param", err.Error())
+		return
+	}
+	filter := bson.M{}
+	if err := addChamberFilter(r, filter); err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect chamber param", err.Error())
+		return
+	}
+	addEdgeFilters(r, filter)
+	edges, err := h.store.GetEdges(congress, filter, window)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error retrieving edge data", err.Error())
+		return
+	}
+	WriteResponse(w, edges)
+}
+
+func (h *handlers) getCommunities(w http.ResponseWriter, r *http.Request) {
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	filter := bson.M{}
+	if err := addChamberFilter(r, filter); err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect chamber param", err.Error())
+		return
+	}
+	communities, err := h.store.GetCommunities(congress, filter)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Error retrieving community data", err.Error())
+		return
+	}
+	WriteResponse(w, communities)
+}
+
+func (h *handlers) getSubjects(w http.ResponseWriter, r *http.Request) {
+	congress, err := CongressOrLatest(r, h.store)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Incorrect congress param", err.Error())
+		return
+	}
+	policyAreas, err := h.store.GetPolicyAreas(bson.M{"congress": congress})
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Error retrieving policy area data", err.Error())
 		return
 	}
-	subjects, err := database.GetSubjects(bson.M{})
+	subjects, err := h.store.GetSubjects(bson.M{"congress": congress})
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Error retrieving subject data", err.Error())
 		return
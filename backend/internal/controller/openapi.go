@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"backend/internal/database"
+	"backend/pkg/search"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// operation is a /api/v1 endpoint, declared once for routing, validation and the OpenAPI document
+// data and meta are the schemas of the response envelope's members
+type operation struct {
+	id      string
+	path    string
+	summary string
+	params  []param
+	data    schema
+	meta    schema
+	handle  func(*handlers, http.ResponseWriter, *http.Request)
+}
+
+// schema is an OpenAPI schema object
+type schema map[string]interface{}
+
+func ref(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items schema) schema {
+	return schema{"type": "array", "items": items}
+}
+
+const bioguidePattern = `^[A-Za-z][0-9]{6}$`
+
+var (
+	congressParam = param{name: "congress", in: "query", kind: kindInteger, min: bound(1),
+		description: "Congress number, defaulting to the most recent"}
+	chamberParam = param{name: "chamber", in: "query", kind: kindString, enum: []string{database.House, database.Senate},
+		description: "Chamber"}
+	fromParam = param{name: "from", in: "query", kind: kindDate,
+		description: "Start of the cosponsorship window"}
+	toParam = param{name: "to", in: "query", kind: kindDate,
+		description: "End of the cosponsorship window"}
+	edgesParam = param{name: "edges", in: "query", kind: kindString,
+		enum:        []string{database.EdgesCross, database.EdgesSame, database.EdgesAll},
+		description: "Cell edge kinds to return, defaulting to cross"}
+	weightParam = param{name: "weight", in: "query", kind: kindString,
+		enum: []string{database.WeightCount, database.WeightFractional, database.WeightNewman,
+			database.WeightPairwise, database.WeightOriginal},
+		description: "Cell weighting scheme, defaulting to count"}
+)
+
+// billParams are the bill query and paging params
+var billParams = []param{
+	{name: "q", in: "query", kind: kindString, description: `Full-text search of titles, summaries and subjects with "phrases" and -exclusions, ranking results by relevance`},
+	{name: "billNumbers", in: "query", kind: kindList, pattern: `^([0-9]+|[A-Za-z]+[0-9]+)$`, description: "Bill numbers and IDs (e.g. 1,hr2)"},
+	{name: "query", in: "query", kind: kindString, description: "Case insensitive title substring, * for every title"},
+	{name: "subjects", in: "query", kind: kindList, description: "Legislative subjects, any of which must be present"},
+	{name: "policyArea", in: "query", kind: kindList, description: "Policy areas"},
+	{name: "sponsor", in: "query", kind: kindList, pattern: bioguidePattern, description: "Bioguide IDs of sponsors"},
+	{name: "cosponsor", in: "query", kind: kindList, pattern: bioguidePattern, description: "Bioguide IDs of cosponsors who have not withdrawn"},
+	{name: "bipartisan", in: "query", kind: kindBoolean, description: "Only bills sponsored and cosponsored by more than one party"},
+	{name: "parties", in: "query", kind: kindList, enum: []string{"D", "R", "I", "L"}, description: "Parties each of which must sponsor or cosponsor"},
+	{name: "minScore", in: "query", kind: kindInteger, description: "Least score (Democrats less Republicans)"},
+	{name: "maxScore", in: "query", kind: kindInteger, description: "Greatest score"},
+	{name: "from", in: "query", kind: kindDate, description: "Earliest introduced date"},
+	{name: "to", in: "query", kind: kindDate, description: "Latest introduced date"},
+	{name: "congress", in: "query", kind: kindString, pattern: `^([1-9][0-9]*|all)$`, description: "Congress number or all, defaulting to the most recent"},
+	{name: "type", in: "query", kind: kindList, pattern: `^[A-Za-z]+$`, description: "Bill types (e.g. hr,hjres)"},
+	{name: "limit", in: "query", kind: kindInteger, min: bound(1), max: bound(MaxLimit), description: "Page size, defaulting to 100"},
+	{name: "cursor", in: "query", kind: kindString, description: "Cursor of the next page, from a previous page's meta"},
+	{name: "offset", in: "query", kind: kindInteger, min: bound(0), description: "Number of results to skip"},
+	{name: "sort", in: "query", kind: kindList, pattern: `^-?(number|score|cosponsors|date)$`, description: "Sort keys, prefixed with - to sort descending"},
+	{name: "fields", in: "query", kind: kindList, enum: billFieldNames(), description: "Bill fields to return"},
+}
+
+func billFieldNames() []string {
+	names := []string{}
+	for name := range billFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// operations lists every /api/v1 endpoint
+var operations = []operation{
+	{
+		id: "listBills", path: "/bills", summary: "List or search bills",
+		params: billParams, data: arrayOf(ref("BillResult")), meta: ref("Page"),
+		handle: (*handlers).getBills,
+	},
+	{
+		id: "listMembers", path: "/members", summary: "List the members of a congress",
+		params: []param{congressParam, chamberParam,
+			{name: "party", in: "query", kind: kindString, pattern: `^[A-Za-z]$`, description: "Party held during the congress (e.g. D)"},
+			{name: "state", in: "query", kind: kindString, pattern: `^[A-Za-z]{2}$`, description: "State abbreviation"},
+			{name: "termStart", in: "query", kind: kindDate, description: "Only members who began a term on or after the date"},
+		},
+		data:   arrayOf(ref("Member")),
+		handle: (*handlers).getMembers,
+	},
+	{
+		id: "getMemberMetrics", path: "/members/{id}/metrics", summary: "Get a member's network metrics",
+		params: []param{
+			{name: "id", in: "path", kind: kindString, pattern: `^([A-Za-z][0-9]{6}|[0-9]+)$`, required: true, description: "Bioguide ID or numeric member ID"},
+			congressParam,
+		},
+		data:   ref("MemberMetrics"),
+		handle: (*handlers).getMemberMetrics,
+	},
+	{
+		id: "listCells", path: "/cells", summary: "List the cells of a congress by subject or window",
+		params: []param{congressParam, chamberParam, fromParam, toParam, edgesParam, weightParam,
+			{name: "subjects", in: "query", kind: kindList, description: "Subjects, required unless a window is given"},
+		},
+		data:   arrayOf(ref("Cell")),
+		handle: (*handlers).getCells,
+	},
+	{
+		id: "getCell", path: "/cells/{position}", summary: "Get the cell of a pair of members",
+		params: []param{
+			{name: "position", in: "path", kind: kindString, pattern: `^[A-Z][0-9]{6}_[A-Z][0-9]{6}$`, required: true, description: "Bioguide IDs of the pair, sorted and joined by _"},
+			congressParam, fromParam, toParam, edgesParam, weightParam,
+		},
+		data:   ref("Cell"),
+		handle: (*handlers).getCell,
+	},
+	{
+		id: "listDirectedEdges", path: "/edges/directed", summary: "List cosponsor to sponsor edges",
+		params: []param{congressParam, chamberParam, fromParam, toParam,
+			{name: "source", in: "query", kind: kindString, pattern: bioguidePattern, description: "Bioguide ID of the cosponsor"},
+			{name: "target", in: "query", kind: kindString, pattern: bioguidePattern, description: "Bioguide ID of the sponsor"},
+		},
+		data:   arrayOf(ref("Edge")),
+		handle: (*handlers).getDirectedEdges,
+	},
+	{
+		id: "getDirectedEdge", path: "/edges/directed/{source}/{target}", summary: "Get the edge from a cosponsor to a sponsor",
+		params: []param{
+			{name: "source", in: "path", kind: kindString, pattern: bioguidePattern, required: true, description: "Bioguide ID of the cosponsor"},
+			{name: "target", in: "path", kind: kindString, pattern: bioguidePattern, required: true, description: "Bioguide ID of the sponsor"},
+			congressParam, fromParam, toParam,
+		},
+		data:   ref("Edge"),
+		handle: (*handlers).getDirectedEdge,
+	},
+	{
+		id: "listCommunities", path: "/communities", summary: "List the member communities of a congress",
+		params: []param{congressParam, chamberParam},
+		data:   arrayOf(ref("Community")),
+		handle: (*handlers).getCommunities,
+	},
+	{
+		id: "getSubjects", path: "/subjects", summary: "List the policy areas and subjects of a congress",
+		params: []param{congressParam},
+		data:   ref("SubjectIndex"),
+		handle: (*handlers).getSubjects,
+	},
+}
+
+// schemaOf describes a Go type from its JSON encoding, adding named structs to components
+func schemaOf(t reflect.Type, components map[string]schema) schema {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return schema{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return schemaOf(t.Elem(), components)
+	case t.Kind() == reflect.Slice:
+		return arrayOf(schemaOf(t.Elem(), components))
+	case t.Kind() == reflect.Map:
+		return schema{"type": "object", "additionalProperties": schemaOf(t.Elem(), components)}
+	case t.Kind() == reflect.Bool:
+		return schema{"type": "boolean"}
+	case t.Kind() == reflect.String:
+		return schema{"type": "string"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return schema{"type": "number"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return schema{"type": "integer"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := components[t.Name()]; !ok {
+			components[t.Name()] = nil
+			properties := schema{}
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				name := strings.Split(f.Tag.Get("json"), ",")[0]
+				if name == "-" || f.PkgPath != "" {
+					continue
+				}
+				if name == "" {
+					name = f.Name
+				}
+				properties[name] = schemaOf(f.Type, components)
+			}
+			components[t.Name()] = schema{"type": "object", "properties": properties}
+		}
+		return ref(t.Name())
+	}
+	return schema{}
+}
+
+// openAPI builds the OpenAPI 3 document describing the /api/v1 operations
+func openAPI() schema {
+	components := map[string]schema{}
+	for _, v := range []interface{}{database.Bill{}, database.Member{}, database.Cell{}, database.Edge{},
+		database.Community{}, database.PolicyArea{}, database.Subject{}, search.Highlights{}} {
+		schemaOf(reflect.TypeOf(v), components)
+	}
+	schemaOf(reflect.TypeOf(pageMeta{}), components)
+	components["Page"] = components["pageMeta"]
+	delete(components, "pageMeta")
+	components["BillResult"] = schema{"allOf": []schema{ref("Bill"), {
+		"type":        "object",
+		"description": "Searches add each bill's relevance score and highlighted matches",
+		"properties":  schema{"relevance": schema{"type": "number"}, "highlights": ref("Highlights")},
+	}}}
+	components["MemberMetrics"] = schema{"type": "object", "properties": schema{
+		"congress": schema{"type": "integer"}, "bioguideId": schema{"type": "string"},
+		"id": schema{"type": "integer"}, "name": schema{"type": "string"}, "metrics": ref("Metrics"),
+	}}
+	components["SubjectIndex"] = schema{"type": "object", "properties": schema{
+		"policyAreas": arrayOf(ref("PolicyArea")), "subjects": arrayOf(ref("Subject")),
+	}}
+	components["Error"] = schema{"type": "object", "required": []string{"error"}, "properties": schema{
+		"error": schema{"type": "object", "required": []string{"status", "message"}, "properties": schema{
+			"status": schema{"type": "integer"}, "message": schema{"type": "string"}, "detail": schema{"type": "string"},
+		}},
+	}}
+
+	errorResponse := func(description string) schema {
+		return schema{"description": description, "content": schema{"application/json": schema{"schema": ref("Error")}}}
+	}
+	paths := schema{}
+	for _, op := range operations {
+		parameters := []schema{}
+		for _, p := range op.params {
+			parameters = append(parameters, p.openAPI())
+		}
+		envelope := schema{"type": "object", "required": []string{"data"}, "properties": schema{"data": op.data}}
+		if op.meta != nil {
+			envelope["properties"].(schema)["meta"] = op.meta
+		}
+		paths[op.path] = schema{"get": schema{
+			"operationId": op.id,
+			"summary":     op.summary,
+			"parameters":  parameters,
+			"responses": schema{
+				"200": schema{"description": "Success", "content": schema{"application/json": schema{"schema": envelope}}},
+				"400": errorResponse("Invalid request"),
+				"404": errorResponse("Not found"),
+				"500": errorResponse("Server error"),
+			},
+		}}
+	}
+	return schema{
+		"openapi": "3.0.3",
+		"info": schema{
+			"title":       "Cosponsorship API",
+			"version":     "1.0.0",
+			"description": "Bills, members and the cosponsorship networks of each congress",
+		},
+		"servers":    []schema{{"url": "/api/v1"}},
+		"paths":      paths,
+		"components": schema{"schemas": components},
+	}
+}
+
+// openAPI describes a param as an OpenAPI parameter object
+func (p param) openAPI() schema {
+	item := schema{"type": "string"}
+	switch p.kind {
+	case kindInteger, kindBoolean:
+		item["type"] = p.kind
+	case kindDate:
+		item["format"] = "date"
+	}
+	if p.min != nil {
+		item["minimum"] = *p.min
+	}
+	if p.max != nil {
+		item["maximum"] = *p.max
+	}
+	if len(p.enum) > 0 {
+		item["enum"] = p.enum
+	}
+	if p.pattern != "" {
+		item["pattern"] = p.pattern
+	}
+	parameter := schema{"name": p.name, "in": p.in, "description": p.description, "required": p.required, "schema": item}
+	if p.kind == kindList {
+		parameter["schema"] = arrayOf(item)
+		parameter["style"] = "form"
+		parameter["explode"] = false
+	}
+	return parameter
+}
+
+// getOpenAPI serves the OpenAPI document of /api/v1
+func (h *handlers) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	WriteResponse(w, h.spec)
+}
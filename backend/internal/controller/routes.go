@@ -1,27 +1,45 @@
 package controller
 
-import "github.com/gorilla/mux"
+import (
+	"backend/internal/database"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handlers serves the API from a store
+type handlers struct {
+	store database.Store
+	spec  schema
+}
 
 // Router constructor function
-func Router() *mux.Router {
+func Router(store database.Store) *mux.Router {
+	h := &handlers{store: store, spec: openAPI()}
 	router := mux.NewRouter()
-	router.HandleFunc("/api/bills/number", getBillsByNumber).Methods("GET").Queries("billNumbers", "{billNumbers}")
-	router.HandleFunc("/api/bills/title", getBillsByTitle).Methods("GET").Queries(
-		"query", "{query}",
-		"bipartisan", "{bipartisan}",
-		"billNumbers", "{billNumbers}",
-	)
-	router.HandleFunc("/api/bills/title", getBillsByTitle).Methods("GET").Queries(
-		"query", "{query}",
-		"bipartisan", "{bipartisan}",
-	)
-	router.HandleFunc("/api/bills/subject", getBillsBySubjects).Methods("GET").Queries(
-		"subjects", "{subjects}",
-		"bipartisan", "{bipartisan}",
-	)
-	router.HandleFunc("/api/members", getMembers).Methods("GET")
-	router.HandleFunc("/api/cell/{position}", getCell).Methods("GET")
-	router.HandleFunc("/api/cells", getCells).Methods("GET").Queries("subjects", "{subjects}")
-	router.HandleFunc("/api/subjects", getSubjects).Methods("GET")
+	router.HandleFunc("/api/bills", h.getBills).Methods("GET")
+	for _, alias := range []string{"number", "title", "subject", "search"} {
+		router.HandleFunc("/api/bills/"+alias, h.getBills).Methods("GET")
+	}
+	router.HandleFunc("/api/members", h.getMembers).Methods("GET")
+	router.HandleFunc("/api/members/{id}/metrics", h.getMemberMetrics).Methods("GET")
+	router.HandleFunc("/api/cell/{position}", h.getCell).Methods("GET")
+	router.HandleFunc("/api/cells", h.getCells).Methods("GET")
+	router.HandleFunc("/api/edges/directed", h.getDirectedEdges).Methods("GET")
+	router.HandleFunc("/api/edges/directed/{source}/{target}", h.getDirectedEdge).Methods("GET")
+	router.HandleFunc("/api/communities", h.getCommunities).Methods("GET")
+	router.HandleFunc("/api/subjects", h.getSubjects).Methods("GET")
+	router.HandleFunc("/api/export/{collection:bills|members|cells|subjects}", h.getExport).Methods("GET")
+
+	// /api/v1 validates requests against the operations it documents and envelopes every response
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/openapi.json", h.getOpenAPI).Methods("GET")
+	for _, op := range operations {
+		handle := op.handle
+		v1.HandleFunc(op.path, validateRequest(op, func(w http.ResponseWriter, r *http.Request) {
+			handle(h, w, r)
+		})).Methods("GET")
+	}
+	v1.NotFoundHandler = http.HandlerFunc(v1NotFound)
 	return router
 }
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"backend/internal/database"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRouter(t *testing.T) http.Handler {
+	t.Helper()
+	store := database.NewMemory()
+	withdrawn := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, b := range []database.Bill{
+		{Congress: 115, ID: "hr1", Type: "hr", Number: 1, Title: "Old Energy Act", TitleLower: "old energy act"},
+		{Congress: 116, ID: "hr1", Type: "hr", Number: 1, Title: "Energy Act", TitleLower: "energy act",
+			Introduced: time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC), Score: 2, NumDems: 2, MultiParty: false,
+			Sponsors: []database.Sponsor{{BioguideID: "A000001", Party: "D"}},
+			Cosponsors: []database.Cosponsor{
+				{BioguideID: "B000002", Party: "D"},
+				{BioguideID: "C000003", Party: "R", WithdrawnDate: &withdrawn},
+			},
+			Subjects: []string{"Energy"}},
+		{Congress: 116, ID: "hr2", Type: "hr", Number: 2, Title: "Health Act", TitleLower: "health act",
+			Introduced: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), Score: 0, NumDems: 1, NumReps: 1, MultiParty: true,
+			Sponsors:   []database.Sponsor{{BioguideID: "C000003", Party: "R"}},
+			Cosponsors: []database.Cosponsor{{BioguideID: "A000001", Party: "D"}},
+			Subjects:   []string{"Health", "Energy"}},
+		{Congress: 116, ID: "s3", Type: "s", Number: 3, Title: "Senate Energy Act", TitleLower: "senate energy act",
+			Introduced: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), Score: -1, NumReps: 1,
+			Sponsors: []database.Sponsor{{BioguideID: "D000004", Party: "R"}}},
+	} {
+		b := b
+		if err := store.UpsertBill(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.InsertMembers([]interface{}{
+		database.Member{Congress: 116, BioguideID: "A000001", ID: 1, Chamber: database.House, Name: "A", Parties: []string{"D"}, State: "CA",
+			Metrics: &database.Metrics{Degree: 2}},
+		database.Member{Congress: 116, BioguideID: "C000003", ID: 3, Chamber: database.House, Name: "C", Parties: []string{"R"}, State: "TX"},
+		database.Member{Congress: 116, BioguideID: "D000004", ID: 4, Chamber: database.Senate, Name: "D", Parties: []string{"R"}, State: "CA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Router(store)
+}
+
+// get requests path and decodes the JSON response into body
+func get(t *testing.T, router http.Handler, path string, body interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if body != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+			t.Fatalf("%s returned %q: %v", path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+type listedBill struct {
+	Congress int    `json:"congress"`
+	ID       string `json:"id"`
+}
+
+func billKeys(bills []listedBill) string {
+	keys := []string{}
+	for _, b := range bills {
+		keys = append(keys, fmt.Sprintf("%d:%s", b.Congress, b.ID))
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestBillFilters(t *testing.T) {
+	router := testRouter(t)
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"", "116:hr1,116:hr2,116:s3"},
+		{"congress=115", "115:hr1"},
+		{"congress=all", "115:hr1,116:hr1,116:hr2,116:s3"},
+		{"billNumbers=2,s3", "116:hr2,116:s3"},
+		{"billNumbers=HR1&congress=all", "115:hr1,116:hr1"},
+		{"query=ENERGY", "116:hr1,116:s3"},
+		{"query=*", "116:hr1,116:hr2,116:s3"},
+		{"query=energy.", ""},
+		{"subjects=Energy", "116:hr1,116:hr2"},
+		{"subjects=Health,Defense", "116:hr2"},
+		{"sponsor=c000003", "116:hr2"},
+		{"cosponsor=A000001", "116:hr2"},
+		{"cosponsor=C000003", ""},
+		{"bipartisan=true", "116:hr2"},
+		{"parties=D,R", "116:hr2"},
+		{"parties=r", "116:hr2,116:s3"},
+		{"minScore=0", "116:hr1,116:hr2"},
+		{"minScore=-1&maxScore=0", "116:hr2,116:s3"},
+		{"from=2019-02-01&to=2019-05-01", "116:hr2"},
+		{"type=s", "116:s3"},
+		{"type=HR,s&sort=-number", "116:s3,116:hr2,116:hr1"},
+		{"sort=score", "116:s3,116:hr2,116:hr1"},
+		{"sort=-date", "116:s3,116:hr2,116:hr1"},
+	} {
+		var body struct {
+			Bills []listedBill `json:"bills"`
+			Total int64        `json:"total"`
+		}
+		if code := get(t, router, "/api/bills?"+test.query, &body); code != http.StatusOK {
+			t.Errorf("%s returned %d", test.query, code)
+			continue
+		}
+		if got := billKeys(body.Bills); got != test.want || body.Total != int64(len(body.Bills)) {
+			t.Errorf("%s listed %q (total %d), want %q", test.query, got, body.Total, test.want)
+		}
+	}
+}
+
+func TestBillErrors(t *testing.T) {
+	router := testRouter(t)
+	for _, query := range []string{
+		"billNumbers=hr-1", "bipartisan=yes", "parties=X", "minScore=low", "from=2019",
+		"limit=0", "limit=1001", "offset=-1", "cursor=%21", "cursor=MQ&offset=1",
+		"sort=title", "fields=hash",
+	} {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if code := get(t, router, "/api/bills?"+query, &body); code != http.StatusBadRequest || body.Error == "" {
+			t.Errorf("%s returned %d %v", query, code, body)
+		}
+	}
+}
+
+func TestBillPaging(t *testing.T) {
+	router := testRouter(t)
+	seen := []listedBill{}
+	path := "/api/bills?congress=all&limit=3"
+	for pages := 0; path != ""; pages++ {
+		if pages > 2 {
+			t.Fatalf("paging did not end")
+		}
+		var body struct {
+			Bills []listedBill `json:"bills"`
+			pageMeta
+		}
+		if code := get(t, router, path, &body); code != http.StatusOK {
+			t.Fatalf("%s returned %d", path, code)
+		}
+		if body.Total != 4 || body.Limit != 3 {
+			t.Errorf("page meta = %+v", body.pageMeta)
+		}
+		seen = append(seen, body.Bills...)
+		path = ""
+		if body.NextCursor != "" {
+			path = "/api/bills?congress=all&limit=3&cursor=" + body.NextCursor
+		}
+	}
+	if got := billKeys(seen); got != "115:hr1,116:hr1,116:hr2,116:s3" {
+		t.Errorf("pages listed %q", got)
+	}
+
+	var body []map[string]json.RawMessage
+	var page struct {
+		Bills *[]map[string]json.RawMessage `json:"bills"`
+	}
+	page.Bills = &body
+	if code := get(t, router, "/api/bills?fields=id,title&offset=2", &page); code != http.StatusOK {
+		t.Fatalf("fields returned %d", code)
+	}
+	if len(body) != 1 || len(body[0]) != 2 || string(body[0]["id"]) != `"s3"` {
+		t.Errorf("selected fields = %v", body)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	router := testRouter(t)
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"", "A000001,C000003,D000004"},
+		{"chamber=senate", "D000004"},
+		{"party=r&state=ca", "D000004"},
+		{"congress=115", ""},
+	} {
+		var body memberList
+		if code := get(t, router, "/api/members?"+test.query, &body); code != http.StatusOK {
+			t.Errorf("%s returned %d", test.query, code)
+			continue
+		}
+		ids := []string{}
+		for _, m := range body.Members {
+			ids = append(ids, m.BioguideID)
+			if _, ok := body.MemberMap[m.BioguideID]; !ok {
+				t.Errorf("%s missing from the member map", m.BioguideID)
+			}
+		}
+		if got := strings.Join(ids, ","); got != test.want {
+			t.Errorf("%s listed %q, want %q", test.query, got, test.want)
+		}
+	}
+	if code := get(t, router, "/api/members?chamber=both", nil); code != http.StatusBadRequest {
+		t.Errorf("unknown chamber returned %d", code)
+	}
+
+	var metrics struct {
+		BioguideID string            `json:"bioguideId"`
+		Metrics    *database.Metrics `json:"metrics"`
+	}
+	if code := get(t, router, "/api/members/1/metrics", &metrics); code != http.StatusOK ||
+		metrics.BioguideID != "A000001" || metrics.Metrics == nil || metrics.Metrics.Degree != 2 {
+		t.Errorf("metrics by ID returned %d %+v", code, metrics)
+	}
+	if code := get(t, router, "/api/members/a000001/metrics", &metrics); code != http.StatusOK || metrics.BioguideID != "A000001" {
+		t.Errorf("metrics by bioguide ID returned %d %+v", code, metrics)
+	}
+	if code := get(t, router, "/api/members/Z000009/metrics", nil); code != http.StatusNotFound {
+		t.Errorf("unknown member returned %d", code)
+	}
+}
+
+func TestV1(t *testing.T) {
+	router := testRouter(t)
+	var list struct {
+		Data []listedBill `json:"data"`
+		Meta pageMeta     `json:"meta"`
+	}
+	if code := get(t, router, "/api/v1/bills?limit=2&sort=-number", &list); code != http.StatusOK {
+		t.Fatalf("v1 bills returned %d", code)
+	}
+	if got := billKeys(list.Data); got != "116:s3,116:hr2" || list.Meta.Total != 3 || list.Meta.NextCursor == "" {
+		t.Errorf("v1 bills = %q %+v", got, list.Meta)
+	}
+
+	var members struct {
+		Data []database.Member `json:"data"`
+	}
+	if code := get(t, router, "/api/v1/members?chamber=senate", &members); code != http.StatusOK || len(members.Data) != 1 {
+		t.Errorf("v1 members returned %d %+v", code, members)
+	}
+
+	for _, test := range []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/bills?congress=0", http.StatusBadRequest},
+		{"/api/v1/bills?limit=5000", http.StatusBadRequest},
+		{"/api/v1/bills?sort=title", http.StatusBadRequest},
+		{"/api/v1/bills?unknown=1", http.StatusBadRequest},
+		{"/api/v1/bills?type=hr&type=s", http.StatusBadRequest},
+		{"/api/v1/bills?parties=X", http.StatusBadRequest},
+		{"/api/v1/members/a1/metrics", http.StatusBadRequest},
+		{"/api/v1/members/Z000009/metrics", http.StatusNotFound},
+		{"/api/v1/nowhere", http.StatusNotFound},
+	} {
+		var body v1Error
+		if code := get(t, router, test.path, &body); code != test.code || body.Error.Status != test.code || body.Error.Message == "" {
+			t.Errorf("%s returned %d %+v, want %d", test.path, code, body, test.code)
+		}
+	}
+
+	var spec map[string]interface{}
+	if code := get(t, router, "/api/v1/openapi.json", &spec); code != http.StatusOK || spec["openapi"] == nil {
+		t.Errorf("openapi.json returned %d", code)
+	}
+}
+
+// failingStore fails to list congresses, as a store that has lost its connection would
+type failingStore struct {
+	database.Store
+}
+
+func (failingStore) GetCongresses() ([]int, error) {
+	return nil, fmt.Errorf("connection lost")
+}
+
+func TestExportErrors(t *testing.T) {
+	router := testRouter(t)
+	for _, path := range []string{
+		"/api/export/bills?congress=x", "/api/export/bills?format=xml", "/api/export/bills?parties=X",
+		"/api/export/members?chamber=both", "/api/export/cells?from=2019",
+	} {
+		if code := get(t, router, path, nil); code != http.StatusBadRequest {
+			t.Errorf("%s returned %d", path, code)
+		}
+	}
+	if code := get(t, Router(database.NewMemory()), "/api/export/bills?congress=0", nil); code != http.StatusBadRequest {
+		t.Errorf("latest congress of an empty store returned %d", code)
+	}
+
+	router = Router(failingStore{database.NewMemory()})
+	for _, path := range []string{"/api/export/bills?congress=0", "/api/export/bills?q=energy"} {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if code := get(t, router, path, &body); code != http.StatusInternalServerError || body.Error == "" {
+			t.Errorf("%s returned %d %v", path, code, body)
+		}
+	}
+}
@@ -1,25 +1,42 @@
 package controller
 
 import (
+	"backend/internal/database"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// WriteError sends a response with { error, trace }
+// WriteError sends a response with { error, trace }, or { error: { status, message, detail } } under /api/v1
 func WriteError(w http.ResponseWriter, statusCode int, short string, long string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	body := map[string]string{
+	var body interface{} = map[string]string{
 		"error": short,
 		"trace": long,
 	}
+	if _, ok := w.(*v1Writer); ok {
+		body = v1Error{Error: v1ErrorBody{Status: statusCode, Message: short, Detail: long}}
+	}
 	encodedBody, _ := json.Marshal(body)
 	w.Write(encodedBody)
 }
 
-// WriteResponse sends a response with the provided body
+// WriteResponse sends a response with the provided body, wrapped in { data, meta } under /api/v1
 func WriteResponse(w http.ResponseWriter, body interface{}) {
 	if body != nil {
+		if _, ok := w.(*v1Writer); ok {
+			envelope := v1Envelope{Data: body}
+			if e, ok := body.(enveloper); ok {
+				envelope.Data, envelope.Meta = e.envelope()
+			}
+			body = envelope
+		}
 		w.Header().Set("Content-Type", "application/json")
 		encodedBody, err := json.Marshal(body)
 		if err != nil {
@@ -29,3 +46,182 @@ func WriteResponse(w http.ResponseWriter, body interface{}) {
 		w.Write(encodedBody)
 	}
 }
+
+// ParseCongress reads the optional congress param, returning 0 when it is absent
+func ParseCongress(r *http.Request) (int, error) {
+	s := r.FormValue("congress")
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// errNoCongresses is returned in place of the most recent congress when the database holds none
+var errNoCongresses = errors.New("no congresses have been loaded")
+
+// CongressOrLatest reads the congress param, defaulting to the most recent congress in the database
+func CongressOrLatest(r *http.Request, store database.Store) (int, error) {
+	congress, err := ParseCongress(r)
+	if err != nil || congress != 0 {
+		return congress, err
+	}
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return 0, err
+	}
+	if len(congresses) == 0 {
+		return 0, errNoCongresses
+	}
+	return congresses[len(congresses)-1], nil
+}
+
+// CongressOrAll reads the congress param of bill listings like CongressOrLatest, except that all returns 0,
+// standing for every congress
+func CongressOrAll(r *http.Request, store database.Store) (int, error) {
+	if r.FormValue("congress") == "all" {
+		return 0, nil
+	}
+	return CongressOrLatest(r, store)
+}
+
+// ParseWindow reads the optional from and to date params (YYYY-MM-DD)
+func ParseWindow(r *http.Request) (database.Window, error) {
+	window := database.Window{}
+	for param, t := range map[string]*time.Time{"from": &window.From, "to": &window.To} {
+		s := r.FormValue(param)
+		if s == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return window, err
+		}
+		*t = date
+	}
+	return window, nil
+}
+
+// ParseEdges reads the edges param (cross, same or all) as the cell edge kinds to return
+// Cross-party edges are returned when the param is absent
+func ParseEdges(r *http.Request) ([]string, error) {
+	edges := r.FormValue("edges")
+	if edges == "" {
+		edges = database.EdgesCross
+	}
+	return database.EdgeKinds(edges)
+}
+
+// ParseWeight reads the weight param naming the cell weighting scheme to return, defaulting to count
+func ParseWeight(r *http.Request) (string, error) {
+	weight := r.FormValue("weight")
+	if weight == "" {
+		return database.WeightCount, nil
+	}
+	if !database.ValidWeight(weight) {
+		return "", fmt.Errorf("unknown weighting scheme %q", weight)
+	}
+	return weight, nil
+}
+
+// Page sizes applied when the limit param is absent and the largest accepted
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// billSortFields maps the sort param's keys to bill fields
+var billSortFields = map[string]string{
+	"number":     "number",
+	"score":      "score",
+	"cosponsors": "numCosponsors",
+	"date":       "introduced",
+}
+
+// billFields lists the bill fields the fields param may select
+var billFields = map[string]bool{
+	"congress": true, "id": true, "type": true, "number": true, "introduced": true, "title": true,
+	"sponsors": true, "cosponsors": true, "score": true, "numDems": true, "numReps": true, "numInds": true,
+	"numLibs": true, "numCosponsors": true, "multiParty": true, "link": true, "policyArea": true, "subjects": true,
+	"summary": true,
+}
+
+// EncodeCursor returns the opaque cursor resuming a listing at offset
+func EncodeCursor(offset int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(offset, 10)))
+}
+
+// decodeCursor recovers the offset of a cursor returned by EncodeCursor
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("malformed cursor %q", cursor)
+	}
+	offset, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("malformed cursor %q", cursor)
+	}
+	return offset, nil
+}
+
+// ParseBillPage reads the limit, cursor or offset, sort and fields params of a bill listing
+// sort is a comma separated list of number, score, cosponsors and date, each prefixed with - to sort descending
+// Results are always ordered by congress, type and number after the requested keys so pages are stable
+func ParseBillPage(r *http.Request) (database.Page, error) {
+	page := database.Page{Limit: DefaultLimit}
+	if s := r.FormValue("limit"); s != "" {
+		limit, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		page.Limit = limit
+	}
+	cursor, offset := r.FormValue("cursor"), r.FormValue("offset")
+	switch {
+	case cursor != "" && offset != "":
+		return page, errors.New("cursor and offset are exclusive")
+	case cursor != "":
+		o, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.Offset = o
+	case offset != "":
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || o < 0 {
+			return page, fmt.Errorf("offset must be a non-negative integer")
+		}
+		page.Offset = o
+	}
+	seen := map[string]bool{}
+	if s := r.FormValue("sort"); s != "" {
+		for _, key := range strings.Split(s, ",") {
+			prefix := ""
+			if strings.HasPrefix(key, "-") {
+				prefix, key = "-", key[1:]
+			}
+			field, ok := billSortFields[key]
+			if !ok {
+				return page, fmt.Errorf("unknown sort key %q", key)
+			}
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			page.Sort = append(page.Sort, prefix+field)
+		}
+	}
+	for _, field := range []string{"congress", "type", "number"} {
+		if !seen[field] {
+			page.Sort = append(page.Sort, field)
+		}
+	}
+	if s := r.FormValue("fields"); s != "" {
+		for _, field := range strings.Split(s, ",") {
+			if !billFields[field] {
+				return page, fmt.Errorf("unknown bill field %q", field)
+			}
+			page.Fields = append(page.Fields, field)
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// v1Writer marks responses of the /api/v1 routes so WriteResponse and WriteError envelope them
+type v1Writer struct {
+	http.ResponseWriter
+}
+
+// v1Envelope wraps every successful /api/v1 response
+type v1Envelope struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+// v1Error wraps every failed /api/v1 response
+type v1Error struct {
+	Error v1ErrorBody `json:"error"`
+}
+
+type v1ErrorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// enveloper is implemented by response bodies that split into data and meta under /api/v1
+type enveloper interface {
+	envelope() (data, meta interface{})
+}
+
+// Kinds of param values
+const (
+	kindString  = "string"
+	kindInteger = "integer"
+	kindBoolean = "boolean"
+	kindDate    = "date"
+	kindList    = "list"
+)
+
+// param declares a query or path param of an operation, documenting it in the OpenAPI document
+// and validating requests against it
+// Lists are comma separated, with enum and pattern applying to each item
+type param struct {
+	name        string
+	in          string
+	description string
+	kind        string
+	enum        []string
+	pattern     string
+	matcher     *regexp.Regexp
+	min, max    *int
+	required    bool
+}
+
+func bound(n int) *int {
+	return &n
+}
+
+// validate checks a param's value against its declaration
+func (p param) validate(value string) error {
+	switch p.kind {
+	case kindInteger:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", p.name)
+		}
+		if p.min != nil && n < *p.min || p.max != nil && n > *p.max {
+			return fmt.Errorf("%s is out of range", p.name)
+		}
+	case kindBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%s must be true or false", p.name)
+		}
+	case kindDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("%s must be a date (YYYY-MM-DD)", p.name)
+		}
+	case kindList:
+		for _, item := range strings.Split(value, ",") {
+			if err := p.validateString(item); err != nil {
+				return err
+			}
+		}
+	default:
+		return p.validateString(value)
+	}
+	return nil
+}
+
+func (p param) validateString(value string) error {
+	if len(p.enum) > 0 {
+		for _, e := range p.enum {
+			if value == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s", p.name, strings.Join(p.enum, ", "))
+	}
+	if p.matcher != nil && !p.matcher.MatchString(value) {
+		return fmt.Errorf("%q does not match the %s pattern %s", value, p.name, p.pattern)
+	}
+	return nil
+}
+
+// validateRequest rejects requests with params the operation does not declare or whose values do not
+// match their declarations, and envelopes the operation's responses
+// Patterns are compiled here, as the router is built, so a bad pattern fails at startup
+func validateRequest(op operation, next http.HandlerFunc) http.HandlerFunc {
+	params := make([]param, len(op.params))
+	declared := map[string]param{}
+	for i, p := range op.params {
+		if p.pattern != "" {
+			p.matcher = regexp.MustCompile(p.pattern)
+		}
+		params[i] = p
+		declared[p.in+":"+p.name] = p
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w = &v1Writer{w}
+		query := r.URL.Query()
+		for name, values := range query {
+			if _, ok := declared["query:"+name]; !ok {
+				WriteError(w, http.StatusBadRequest, "Unknown param", fmt.Sprintf("%s does not accept %s", op.path, name))
+				return
+			}
+			if len(values) > 1 {
+				WriteError(w, http.StatusBadRequest, "Repeated param", fmt.Sprintf("%s may only be given once", name))
+				return
+			}
+		}
+		vars := mux.Vars(r)
+		for _, p := range params {
+			value, found := vars[p.name]
+			if p.in == "query" {
+				value, found = query.Get(p.name), query.Get(p.name) != ""
+			}
+			if !found {
+				if p.required {
+					WriteError(w, http.StatusBadRequest, "Missing param", fmt.Sprintf("%s is required", p.name))
+					return
+				}
+				continue
+			}
+			if err := p.validate(value); err != nil {
+				WriteError(w, http.StatusBadRequest, "Invalid param", err.Error())
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// v1NotFound answers requests for unknown /api/v1 paths
+func v1NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(&v1Writer{w}, http.StatusNotFound, "Not found", r.URL.Path)
+}
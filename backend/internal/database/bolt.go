@@ -0,0 +1,162 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OpenBolt opens the single file store at path, creating it if necessary
+// Documents are loaded into memory on open, and changed collections are written back by Flush,
+// which ClearPending calls at the end of each stage, and on Disconnect
+func OpenBolt(path string) (Store, error) {
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	collections := map[string]*boltCollection{}
+	err = db.View(func(tx *bbolt.Tx) error {
+		for name := range indexes {
+			c, err := loadBoltCollection(tx, name)
+			if err != nil {
+				return err
+			}
+			collections[name] = c
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	fmt.Printf("Opened database file %s...\n", path)
+
+	return newStore(func(name string) collection {
+		return collections[name]
+	}, func() error {
+		return flushBolt(db, collections)
+	}, func() {
+		if err := flushBolt(db, collections); err != nil {
+			fmt.Println("Unable to write database file: " + err.Error())
+		}
+		db.Close()
+		fmt.Printf("Closed database file %s...\n", path)
+	}), nil
+}
+
+// boltCollection is a memory collection backed by a bucket of BSON documents
+type boltCollection struct {
+	*memoryCollection
+	name    string
+	dirtyMu sync.Mutex
+	dirty   bool
+}
+
+func loadBoltCollection(tx *bbolt.Tx, name string) (*boltCollection, error) {
+	c := &boltCollection{memoryCollection: &memoryCollection{}, name: name}
+	if err := c.memoryCollection.createIndexes(indexes[name]); err != nil {
+		return nil, err
+	}
+	b := tx.Bucket([]byte(name))
+	if b == nil {
+		return c, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		doc := primitive.M{}
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return fmt.Errorf("bad document in %s: %v", name, err)
+		}
+		c.docs = append(c.docs, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, c.reindex()
+}
+
+// flushBolt rewrites the bucket of every changed collection in a single transaction
+func flushBolt(db *bbolt.DB, collections map[string]*boltCollection) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		for _, c := range collections {
+			if err := c.write(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *boltCollection) write(tx *bbolt.Tx) error {
+	c.dirtyMu.Lock()
+	defer c.dirtyMu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	if tx.Bucket([]byte(c.name)) != nil {
+		if err := tx.DeleteBucket([]byte(c.name)); err != nil {
+			return err
+		}
+	}
+	b, err := tx.CreateBucket([]byte(c.name))
+	if err != nil {
+		return err
+	}
+	c.memoryCollection.mu.RLock()
+	defer c.memoryCollection.mu.RUnlock()
+	for i, doc := range c.docs {
+		v, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, uint64(i))
+		if err := b.Put(k, v); err != nil {
+			return err
+		}
+	}
+	c.dirty = false
+	return nil
+}
+
+// changed marks the collection for writing once an operation has run
+func (c *boltCollection) changed(err error) error {
+	c.dirtyMu.Lock()
+	c.dirty = true
+	c.dirtyMu.Unlock()
+	return err
+}
+
+func (c *boltCollection) drop() error {
+	return c.changed(c.memoryCollection.drop())
+}
+
+func (c *boltCollection) insertMany(docs []interface{}) error {
+	return c.changed(c.memoryCollection.insertMany(docs))
+}
+
+func (c *boltCollection) updateOne(filter, update bson.M, upsert bool) error {
+	return c.changed(c.memoryCollection.updateOne(filter, update, upsert))
+}
+
+func (c *boltCollection) updateMany(filter, update bson.M, upsert bool) error {
+	return c.changed(c.memoryCollection.updateMany(filter, update, upsert))
+}
+
+func (c *boltCollection) replaceOne(filter bson.M, replacement interface{}, upsert bool) error {
+	return c.changed(c.memoryCollection.replaceOne(filter, replacement, upsert))
+}
+
+func (c *boltCollection) deleteMany(filter bson.M) error {
+	return c.changed(c.memoryCollection.deleteMany(filter))
+}
+
+func (c *boltCollection) bulkWrite(writes []write) error {
+	return c.changed(c.memoryCollection.bulkWrite(writes))
+}
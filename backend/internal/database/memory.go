@@ -0,0 +1,498 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMemory returns a store held entirely in process memory
+// It needs no external services, which makes it suitable for tests and demos
+func NewMemory() Store {
+	return newStore(func(name string) collection {
+		c := &memoryCollection{}
+		c.createIndexes(indexes[name])
+		return c
+	}, nil, nil)
+}
+
+// memoryCollection is a collection held in process memory
+// Unique indexes are enforced and answer equality lookups without a scan
+type memoryCollection struct {
+	mu      sync.RWMutex
+	docs    []primitive.M
+	uniques []*uniqueIndex
+}
+
+type uniqueIndex struct {
+	fields []string
+	keys   map[string]int
+}
+
+func keyPart(v interface{}) string {
+	if n, ok := number(v); ok {
+		return "n" + strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "s" + t
+	}
+	return fmt.Sprintf("%T%v", v, v)
+}
+
+func (u *uniqueIndex) key(doc primitive.M) string {
+	parts := []string{}
+	for _, field := range u.fields {
+		v, _ := getPath(doc, strings.Split(field, "."))
+		parts = append(parts, keyPart(v))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// lookupKey builds an index key from a filter's equality clauses when it constrains every indexed field
+func (u *uniqueIndex) lookupKey(filter primitive.M) (string, bool) {
+	parts := []string{}
+	for _, field := range u.fields {
+		v, ok := filter[field]
+		if !ok || isOperatorDoc(v) {
+			return "", false
+		}
+		if _, ok := v.(primitive.A); ok {
+			return "", false
+		}
+		parts = append(parts, keyPart(v))
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+func indexFields(keys interface{}) []string {
+	fields := []string{}
+	switch k := keys.(type) {
+	case bson.D:
+		for _, e := range k {
+			fields = append(fields, e.Key)
+		}
+	case bson.M:
+		for field := range k {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func duplicateKeyError(u *uniqueIndex) error {
+	return fmt.Errorf("duplicate key on unique index %s", strings.Join(u.fields, "_"))
+}
+
+func (c *memoryCollection) reindex() error {
+	for _, u := range c.uniques {
+		u.keys = map[string]int{}
+		for i, doc := range c.docs {
+			key := u.key(doc)
+			if _, ok := u.keys[key]; ok {
+				return duplicateKeyError(u)
+			}
+			u.keys[key] = i
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection) drop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs = nil
+	c.uniques = nil
+	return nil
+}
+
+func (c *memoryCollection) createIndexes(models []mongo.IndexModel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, model := range models {
+		if model.Options == nil || model.Options.Unique == nil || !*model.Options.Unique {
+			continue
+		}
+		c.uniques = append(c.uniques, &uniqueIndex{fields: indexFields(model.Keys)})
+	}
+	return c.reindex()
+}
+
+// insert appends a normalized document, enforcing unique indexes
+func (c *memoryCollection) insert(doc primitive.M) error {
+	keys := make([]string, len(c.uniques))
+	for i, u := range c.uniques {
+		keys[i] = u.key(doc)
+		if _, ok := u.keys[keys[i]]; ok {
+			return duplicateKeyError(u)
+		}
+	}
+	for i, u := range c.uniques {
+		u.keys[keys[i]] = len(c.docs)
+	}
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+func (c *memoryCollection) insertMany(docs []interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range docs {
+		doc, err := normalize(d)
+		if err != nil {
+			return err
+		}
+		if err := c.insert(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// positions returns the positions of documents matching a normalized filter
+func (c *memoryCollection) positions(filter primitive.M) ([]int, error) {
+	for _, u := range c.uniques {
+		if key, ok := u.lookupKey(filter); ok {
+			i, found := u.keys[key]
+			if !found {
+				return nil, nil
+			}
+			ok, err := matches(c.docs[i], filter)
+			if err != nil || !ok {
+				return nil, err
+			}
+			return []int{i}, nil
+		}
+	}
+	positions := []int{}
+	for i, doc := range c.docs {
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			positions = append(positions, i)
+		}
+	}
+	return positions, nil
+}
+
+// query returns the matching documents with the find options applied
+// The returned documents are shared with the collection, so callers must hold the read lock while using them
+func (c *memoryCollection) query(filter bson.M, opts *options.FindOptions) ([]primitive.M, error) {
+	f, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := c.positions(f)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]primitive.M, len(positions))
+	for i, p := range positions {
+		docs[i] = c.docs[p]
+	}
+	if opts == nil {
+		return docs, nil
+	}
+	if opts.Sort != nil {
+		sortDocuments(docs, opts.Sort)
+	}
+	if opts.Skip != nil {
+		skip := int(*opts.Skip)
+		if skip > len(docs) {
+			skip = len(docs)
+		}
+		docs = docs[skip:]
+	}
+	if opts.Limit != nil && *opts.Limit > 0 && int(*opts.Limit) < len(docs) {
+		docs = docs[:*opts.Limit]
+	}
+	if opts.Projection != nil {
+		for i, doc := range docs {
+			docs[i] = project(doc, opts.Projection)
+		}
+	}
+	return docs, nil
+}
+
+func (c *memoryCollection) find(filter bson.M, opts *options.FindOptions, results interface{}) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docs, err := c.query(filter, opts)
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("results must be a pointer to a slice")
+	}
+	slice := reflect.MakeSlice(rv.Elem().Type(), 0, len(docs))
+	for _, doc := range docs {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if err := decode(doc, elem.Interface()); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem.Elem())
+	}
+	rv.Elem().Set(slice)
+	return nil
+}
+
+// each decodes matching documents one at a time, holding the read lock until fn has seen them all
+func (c *memoryCollection) each(filter bson.M, opts *options.FindOptions, fn func(decode func(v interface{}) error) error) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docs, err := c.query(filter, opts)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		doc := doc
+		if err := fn(func(v interface{}) error { return decode(doc, v) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection) findOne(filter bson.M, result interface{}) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docs, err := c.query(filter, options.Find().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return ErrNoDocuments
+	}
+	return decode(docs[0], result)
+}
+
+func (c *memoryCollection) distinct(field string, filter bson.M) ([]interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docs, err := c.query(filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	for _, doc := range docs {
+		for _, v := range expand(lookup(doc, strings.Split(field, "."))) {
+			if _, ok := v.(primitive.A); ok {
+				continue
+			}
+			if !matchEqual(values, v) {
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (c *memoryCollection) count(filter bson.M) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f, err := normalize(filter)
+	if err != nil {
+		return 0, err
+	}
+	positions, err := c.positions(f)
+	return int64(len(positions)), err
+}
+
+// touchesIndex reports whether an update may change a uniquely indexed field
+func (c *memoryCollection) touchesIndex(update primitive.M) bool {
+	for _, arg := range update {
+		fields, _ := arg.(primitive.M)
+		for key := range fields {
+			root := strings.Split(key, ".")[0]
+			for _, u := range c.uniques {
+				for _, field := range u.fields {
+					if strings.Split(field, ".")[0] == root {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// replaceAt swaps the document at position i, enforcing unique indexes
+func (c *memoryCollection) replaceAt(i int, doc primitive.M) error {
+	for _, u := range c.uniques {
+		if j, ok := u.keys[u.key(doc)]; ok && j != i {
+			return duplicateKeyError(u)
+		}
+	}
+	for _, u := range c.uniques {
+		delete(u.keys, u.key(c.docs[i]))
+		u.keys[u.key(doc)] = i
+	}
+	c.docs[i] = doc
+	return nil
+}
+
+func (c *memoryCollection) update(filter, update bson.M, upsert, many bool) error {
+	f, err := normalize(filter)
+	if err != nil {
+		return err
+	}
+	u, err := normalize(update)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	positions, err := c.positions(f)
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		if !upsert {
+			return nil
+		}
+		doc := upsertDocument(f)
+		if err := applyUpdate(doc, u, true); err != nil {
+			return err
+		}
+		return c.insert(doc)
+	}
+	if !many {
+		positions = positions[:1]
+	}
+	indexed := c.touchesIndex(u)
+	for _, i := range positions {
+		if !indexed {
+			if err := applyUpdate(c.docs[i], u, false); err != nil {
+				return err
+			}
+			continue
+		}
+		doc, err := normalize(c.docs[i])
+		if err != nil {
+			return err
+		}
+		if err := applyUpdate(doc, u, false); err != nil {
+			return err
+		}
+		if err := c.replaceAt(i, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection) updateOne(filter, update bson.M, upsert bool) error {
+	return c.update(filter, update, upsert, false)
+}
+
+func (c *memoryCollection) updateMany(filter, update bson.M, upsert bool) error {
+	return c.update(filter, update, upsert, true)
+}
+
+func (c *memoryCollection) replaceOne(filter bson.M, replacement interface{}, upsert bool) error {
+	f, err := normalize(filter)
+	if err != nil {
+		return err
+	}
+	doc, err := normalize(replacement)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	positions, err := c.positions(f)
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		if !upsert {
+			return nil
+		}
+		return c.insert(doc)
+	}
+	return c.replaceAt(positions[0], doc)
+}
+
+func (c *memoryCollection) deleteMany(filter bson.M) error {
+	f, err := normalize(filter)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	positions, err := c.positions(f)
+	if err != nil || len(positions) == 0 {
+		return err
+	}
+	remove := map[int]bool{}
+	for _, i := range positions {
+		remove[i] = true
+	}
+	kept := []primitive.M{}
+	for i, doc := range c.docs {
+		if !remove[i] {
+			kept = append(kept, doc)
+		}
+	}
+	c.docs = kept
+	return c.reindex()
+}
+
+// bulkWrite applies the writes under a single lock, compacting deleted documents once at the end
+func (c *memoryCollection) bulkWrite(writes []write) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remove := map[int]bool{}
+	for _, w := range writes {
+		f, err := normalize(w.filter)
+		if err != nil {
+			return err
+		}
+		positions, err := c.positions(f)
+		if err != nil {
+			return err
+		}
+		if w.replacement == nil {
+			for _, i := range positions {
+				remove[i] = true
+			}
+			continue
+		}
+		doc, err := normalize(w.replacement)
+		if err != nil {
+			return err
+		}
+		if len(positions) == 0 {
+			err = c.insert(doc)
+		} else {
+			err = c.replaceAt(positions[0], doc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+	kept := []primitive.M{}
+	for i, doc := range c.docs {
+		if !remove[i] {
+			kept = append(kept, doc)
+		}
+	}
+	c.docs = kept
+	return c.reindex()
+}
@@ -1,52 +1,504 @@
 package database
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // Bill describes a piece of legislation
+// ID combines type and number (e.g. hr1, sjres20) and is unique within a congress
+// NumCosponsors counts the cosponsors who have not withdrawn
+// Summary is the plain text of the latest CRS summary, if any
+// Hash is the content hash of the source file and Pending lists the stages yet to process this version
 type Bill struct {
-	Number     int      `json:"number" bson:"number"`
-	Title      string   `json:"title" bson:"title"`
-	TitleLower string   `json:"-" bson:"titleLower"`
-	Sponsors   []string `json:"sponsors" bson:"sponsors"`
-	Cosponsors []string `json:"cosponsors" bson:"cosponsors"`
-	Score      int      `json:"score" bson:"score"`
-	NumDems    int      `json:"numDems" bson:"numDems"`
-	NumReps    int      `json:"numReps" bson:"numReps"`
-	NumInds    int      `json:"numInds" bson:"numInds"`
-	NumLibs    int      `json:"numLibs" bson:"numLibs"`
-	MultiParty bool     `json:"multiParty" bson:"multiParty"`
-	Link       string   `json:"link" bson:"link"`
-	PolicyArea string   `json:"policyArea" bson:"policyArea"`
-	Subjects   []string `json:"subjects" bson:"subjects"`
+	Congress      int         `json:"congress" bson:"congress"`
+	ID            string      `json:"id" bson:"id"`
+	Type          string      `json:"type" bson:"type"`
+	Number        int         `json:"number" bson:"number"`
+	Introduced    time.Time   `json:"introduced" bson:"introduced"`
+	Title         string      `json:"title" bson:"title"`
+	TitleLower    string      `json:"-" bson:"titleLower"`
+	Sponsors      []Sponsor   `json:"sponsors" bson:"sponsors"`
+	Cosponsors    []Cosponsor `json:"cosponsors" bson:"cosponsors"`
+	Score         int         `json:"score" bson:"score"`
+	NumDems       int         `json:"numDems" bson:"numDems"`
+	NumReps       int         `json:"numReps" bson:"numReps"`
+	NumInds       int         `json:"numInds" bson:"numInds"`
+	NumLibs       int         `json:"numLibs" bson:"numLibs"`
+	NumCosponsors int         `json:"numCosponsors" bson:"numCosponsors"`
+	MultiParty    bool        `json:"multiParty" bson:"multiParty"`
+	Link          string      `json:"link" bson:"link"`
+	PolicyArea    string      `json:"policyArea" bson:"policyArea"`
+	Subjects      []string    `json:"subjects" bson:"subjects"`
+	Summary       string      `json:"summary" bson:"summary"`
+	Hash          string      `json:"-" bson:"hash"`
+	Pending       []string    `json:"-" bson:"pending"`
+}
+
+// Stages downstream of bill ingestion that process changed bills
+const (
+	StageMembers  = "members"
+	StageCells    = "cells"
+	StageSubjects = "subjects"
+	StageSearch   = "search"
+)
+
+// Stages lists every downstream stage in pipeline order
+var Stages = []string{StageMembers, StageCells, StageSubjects, StageSearch}
+
+// Sponsor identifies a member on a bill
+// Name is the member's full string (e.g. "Smith, Adam [D-WA-9]") as it appears in Member.FullStrings
+// Party is the member's party when the bill was introduced, taken from their timeline once members are populated
+type Sponsor struct {
+	Name       string `json:"name" bson:"name"`
+	BioguideID string `json:"bioguideId" bson:"bioguideId"`
+	Party      string `json:"party" bson:"party"`
+}
+
+// Cosponsor describes a member's cosponsorship of a bill
+// Party is the member's party on the sponsorship date
+type Cosponsor struct {
+	Name          string     `json:"name" bson:"name"`
+	BioguideID    string     `json:"bioguideId" bson:"bioguideId"`
+	Party         string     `json:"party" bson:"party"`
+	Date          time.Time  `json:"date" bson:"date"`
+	Original      bool       `json:"original" bson:"original"`
+	WithdrawnDate *time.Time `json:"withdrawnDate,omitempty" bson:"withdrawnDate,omitempty"`
+}
+
+// Withdrawn reports whether the member withdrew their cosponsorship
+func (c Cosponsor) Withdrawn() bool {
+	return c.WithdrawnDate != nil
 }
 
-// Member describes a member of the House
+// SponsorNames returns the full strings of the bill's sponsors
+func (b Bill) SponsorNames() []string {
+	names := []string{}
+	for _, s := range b.Sponsors {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// ActiveCosponsors returns the names of cosponsors who have not withdrawn
+func (b Bill) ActiveCosponsors() []string {
+	names := []string{}
+	for _, c := range b.Cosponsors {
+		if !c.Withdrawn() {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Chamber returns the chamber in which the bill originated
+func (b Bill) Chamber() string {
+	if strings.HasPrefix(b.Type, "s") {
+		return Senate
+	}
+	return House
+}
+
+// Chambers of Congress as stored on members and cells
+const (
+	House  = "house"
+	Senate = "senate"
+)
+
+// Member describes a member of the House or Senate
+// BioguideID identifies the member across congresses and rebuilds; ID is derived from it by MemberIndex
+// Counts is keyed by the bioguide ID of each cosponsoring member
+// The biographical fields are filled from the congress-legislators data when it is imported
+// Metrics and Community are filled by PopulateMetrics and PopulateCommunities once the cells are built
+// Community numbers start at 1 and run on across both chambers of a congress, and 0 marks a member without cells
+// Senators have no districts
 type Member struct {
-	ID          int            `json:"id" bson:"id"`
-	Name        string         `json:"name" bson:"name"`
-	Parties     []string       `json:"parties" bson:"parties"`
-	Districts   []string       `json:"districts" bson:"districts"`
-	State       string         `json:"state" bson:"state"`
-	FullStrings []string       `json:"-" bson:"fullStrings"`
-	Counts      map[string]int `json:"counts" bson:"counts"`
+	Congress        int               `json:"congress" bson:"congress"`
+	BioguideID      string            `json:"bioguideId" bson:"bioguideId"`
+	ID              int               `json:"id" bson:"id"`
+	Chamber         string            `json:"chamber" bson:"chamber"`
+	Name            string            `json:"name" bson:"name"`
+	Parties         []string          `json:"parties" bson:"parties"`
+	Districts       []string          `json:"districts" bson:"districts"`
+	State           string            `json:"state" bson:"state"`
+	FullStrings     []string          `json:"-" bson:"fullStrings"`
+	Counts          map[string]int    `json:"counts" bson:"counts"`
+	PartyHistory    []PartyInterval   `json:"partyHistory" bson:"partyHistory"`
+	OfficialName    string            `json:"officialName,omitempty" bson:"officialName,omitempty"`
+	Birthday        *time.Time        `json:"birthday,omitempty" bson:"birthday,omitempty"`
+	Gender          string            `json:"gender,omitempty" bson:"gender,omitempty"`
+	Terms           []Term            `json:"terms,omitempty" bson:"terms,omitempty"`
+	LeadershipRoles []LeadershipRole  `json:"leadershipRoles,omitempty" bson:"leadershipRoles,omitempty"`
+	Social          map[string]string `json:"social,omitempty" bson:"social,omitempty"`
+	Metrics         *Metrics          `json:"metrics,omitempty" bson:"metrics,omitempty"`
+	Community       int               `json:"community,omitempty" bson:"community,omitempty"`
+}
+
+// Metrics holds a member's centrality in the cross-party cosponsorship network of their congress
+// Weighted measures use cell counts, and betweenness counts shortest paths by hops
+type Metrics struct {
+	Degree         int     `json:"degree" bson:"degree"`
+	WeightedDegree float64 `json:"weightedDegree" bson:"weightedDegree"`
+	Betweenness    float64 `json:"betweenness" bson:"betweenness"`
+	Eigenvector    float64 `json:"eigenvector" bson:"eigenvector"`
+	PageRank       float64 `json:"pageRank" bson:"pageRank"`
+}
+
+// PartyInterval is a span during which a member belonged to a party (e.g. D)
+// End is nil when the interval is open ended
+type PartyInterval struct {
+	Party string     `json:"party" bson:"party"`
+	Start time.Time  `json:"start" bson:"start"`
+	End   *time.Time `json:"end,omitempty" bson:"end,omitempty"`
+}
+
+// PartyAt returns the member's party on the supplied date
+// Dates outside the history take the nearest interval's party
+func (m Member) PartyAt(t time.Time) string {
+	if len(m.PartyHistory) == 0 {
+		if len(m.Parties) == 0 {
+			return ""
+		}
+		return m.Parties[0]
+	}
+	party := m.PartyHistory[0].Party
+	for _, interval := range m.PartyHistory {
+		if t.Before(interval.Start) {
+			break
+		}
+		party = interval.Party
+		if interval.End == nil || t.Before(*interval.End) {
+			break
+		}
+	}
+	return party
+}
+
+// CongressEnd returns the date a congress ends, when the next one convenes on January 3rd
+func CongressEnd(congress int) time.Time {
+	return time.Date(1789+2*congress, time.January, 3, 0, 0, 0, 0, time.UTC)
+}
+
+// Term describes a single term of service
+// Type is rep or sen and Party is the full party name (e.g. Democrat)
+type Term struct {
+	Type     string    `json:"type" bson:"type"`
+	Start    time.Time `json:"start" bson:"start"`
+	End      time.Time `json:"end" bson:"end"`
+	State    string    `json:"state" bson:"state"`
+	District string    `json:"district,omitempty" bson:"district,omitempty"`
+	Party    string    `json:"party" bson:"party"`
+}
+
+// LeadershipRole describes a leadership position such as Speaker or Minority Whip
+// End is nil while the role is held
+type LeadershipRole struct {
+	Title   string     `json:"title" bson:"title"`
+	Chamber string     `json:"chamber" bson:"chamber"`
+	Start   time.Time  `json:"start" bson:"start"`
+	End     *time.Time `json:"end,omitempty" bson:"end,omitempty"`
+}
+
+// MemberIndex derives a stable integer from a bioguide ID (e.g. S000510 becomes 19000510)
+// The letter supplies the leading digits and the numeric part the rest, so distinct IDs never collide
+func MemberIndex(bioguideID string) (int, error) {
+	if len(bioguideID) < 2 || bioguideID[0] < 'A' || bioguideID[0] > 'Z' {
+		return 0, fmt.Errorf("malformed bioguide ID %q", bioguideID)
+	}
+	n, err := strconv.Atoi(bioguideID[1:])
+	if err != nil || n < 0 || n >= 1000000 {
+		return 0, fmt.Errorf("malformed bioguide ID %q", bioguideID)
+	}
+	return int(bioguideID[0]-'A'+1)*1000000 + n, nil
+}
+
+// CellPosition joins the bioguide IDs of a pair of members in ascending order
+func CellPosition(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "_" + b
+}
+
+// Edge kinds of a cell, by whether the pair held different parties or the same party on the shared bills
+const (
+	EdgesCross = "cross"
+	EdgesSame  = "same"
+)
+
+// EdgesAll is the edge policy selecting every kind of cell
+const EdgesAll = "all"
+
+// EdgeKinds returns the kinds of cell selected by an edge policy (cross, same or all)
+func EdgeKinds(policy string) ([]string, error) {
+	switch policy {
+	case EdgesCross, EdgesSame:
+		return []string{policy}, nil
+	case EdgesAll:
+		return []string{EdgesCross, EdgesSame}, nil
+	}
+	return nil, fmt.Errorf("unknown edge policy %q", policy)
+}
+
+// Weighting schemes of a cell's shared bills
+// Count weighs every bill equally, fractional weighs a bill with n members by 1/(n-1) (Newman's
+// collaboration weight, also accepted as newman), pairwise by 2/(n(n-1)) so each bill contributes one
+// unit across all of its pairs, and original counts only the bills both members joined as originals
+const (
+	WeightCount      = "count"
+	WeightFractional = "fractional"
+	WeightNewman     = "newman"
+	WeightPairwise   = "pairwise"
+	WeightOriginal   = "original"
+)
+
+// Share records what a bill contributes to a cell: the number of members on it and whether
+// both members of the pair were on it from introduction
+type Share struct {
+	Members  int  `bson:"members"`
+	Original bool `bson:"original"`
+}
+
+// Weights holds a cell's alternative weightings, kept alongside its count
+type Weights struct {
+	Fractional float64 `json:"fractional" bson:"fractional"`
+	Pairwise   float64 `json:"pairwise" bson:"pairwise"`
+	Original   int     `json:"original" bson:"original"`
 }
 
 // Cell describes the adjacency matrix cell data
+// Position is built by CellPosition from the bioguide IDs of the pair, and a pair has one cell per edge kind
+// BillIDs maps each shared bill to the date both members were on it and Shares to its contribution to Weights
+// Cells merged across edge kinds (see GetCells) carry EdgesAll
+// Weight holds the weighting selected by a query and is not stored
 type Cell struct {
-	Position    string       `json:"position" bson:"position"`
-	Count       int          `json:"count" bson:"count"`
-	BillNumbers map[int]bool `json:"-" bson:"billNumbers"`
-	Bills       []Bill       `json:"bills" bson:"-"`
-	PolicyAreas []string     `json:"policyAreas" bson:"policyAreas"`
-	Subjects    []string     `json:"subjects" bson:"subjects"`
+	Congress    int                  `json:"congress" bson:"congress"`
+	Chamber     string               `json:"chamber" bson:"chamber"`
+	Position    string               `json:"position" bson:"position"`
+	Edges       string               `json:"edges" bson:"edges"`
+	Count       int                  `json:"count" bson:"count"`
+	Weights     Weights              `json:"-" bson:"weights"`
+	Weight      float64              `json:"weight" bson:"-"`
+	BillIDs     map[string]time.Time `json:"-" bson:"billIds"`
+	Shares      map[string]Share     `json:"-" bson:"shares"`
+	Bills       []Bill               `json:"bills" bson:"-"`
+	PolicyAreas []string             `json:"policyAreas" bson:"policyAreas"`
+	Subjects    []string             `json:"subjects" bson:"subjects"`
+}
+
+// merge adds the bills, policy areas and subjects of another cell of the same pair
+func (c *Cell) merge(other Cell) {
+	if c.Edges != other.Edges {
+		c.Edges = EdgesAll
+	}
+	for billID, date := range other.BillIDs {
+		c.BillIDs[billID] = date
+	}
+	if c.Shares == nil {
+		c.Shares = map[string]Share{}
+	}
+	for billID, share := range other.Shares {
+		c.Shares[billID] = share
+	}
+	c.Tally()
+	c.PolicyAreas = union(c.PolicyAreas, other.PolicyAreas)
+	c.Subjects = union(c.Subjects, other.Subjects)
+}
+
+// union returns the sorted distinct strings of a and b
+func union(a, b []string) []string {
+	set := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		set[s] = true
+	}
+	out := []string{}
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// filterBills keeps only the bills satisfying keep and recomputes the count and weights
+func (c *Cell) filterBills(keep func(billID string, date time.Time) bool) {
+	billIDs := map[string]time.Time{}
+	for billID, date := range c.BillIDs {
+		if keep(billID, date) {
+			billIDs[billID] = date
+		}
+	}
+	c.BillIDs = billIDs
+	c.Tally()
+}
+
+// Tally recomputes the count and weights from the cell's bills
+func (c *Cell) Tally() {
+	c.Count = len(c.BillIDs)
+	c.Weights = Weights{}
+	for billID := range c.BillIDs {
+		share := c.Shares[billID]
+		if n := float64(share.Members); n > 1 {
+			c.Weights.Fractional += 1 / (n - 1)
+			c.Weights.Pairwise += 2 / (n * (n - 1))
+		}
+		if share.Original {
+			c.Weights.Original++
+		}
+	}
+}
+
+// ValidWeight reports whether scheme names a weighting scheme
+func ValidWeight(scheme string) bool {
+	switch scheme {
+	case WeightCount, WeightFractional, WeightNewman, WeightPairwise, WeightOriginal:
+		return true
+	}
+	return false
+}
+
+// SetWeight fills Weight with the cell's weighting under scheme, which must be valid
+func (c *Cell) SetWeight(scheme string) {
+	switch scheme {
+	case WeightFractional, WeightNewman:
+		c.Weight = c.Weights.Fractional
+	case WeightPairwise:
+		c.Weight = c.Weights.Pairwise
+	case WeightOriginal:
+		c.Weight = float64(c.Weights.Original)
+	default:
+		c.Weight = float64(c.Count)
+	}
+}
+
+// Edge describes a directed edge from a cosponsor to the sponsor of the bills they joined
+// Source and Target are bioguide IDs, and BillIDs maps each such bill to the date the cosponsor joined it
+type Edge struct {
+	Congress int                  `json:"congress" bson:"congress"`
+	Chamber  string               `json:"chamber" bson:"chamber"`
+	Source   string               `json:"source" bson:"source"`
+	Target   string               `json:"target" bson:"target"`
+	Count    int                  `json:"count" bson:"count"`
+	BillIDs  map[string]time.Time `json:"-" bson:"billIds"`
+	Bills    []Bill               `json:"bills" bson:"-"`
+}
+
+// filterBills keeps only the bills satisfying keep and recomputes the count
+func (e *Edge) filterBills(keep func(billID string, date time.Time) bool) {
+	billIDs := map[string]time.Time{}
+	for billID, date := range e.BillIDs {
+		if keep(billID, date) {
+			billIDs[billID] = date
+		}
+	}
+	e.BillIDs = billIDs
+	e.Count = len(billIDs)
+}
+
+// Community summarizes a community of members found in a congress's cosponsorship network
+// Parties counts members by their party at the end of the congress, PolicyAreas ranks the policy areas of
+// the bills shared inside the community, and Density is the share of member pairs joined by a cell
+type Community struct {
+	Congress        int               `json:"congress"`
+	Community       int               `json:"community"`
+	Chamber         string            `json:"chamber"`
+	Members         []string          `json:"members"`
+	Parties         map[string]int    `json:"parties"`
+	PolicyAreas     []PolicyAreaCount `json:"policyAreas"`
+	InternalEdges   int               `json:"internalEdges"`
+	CrossPartyEdges int               `json:"crossPartyEdges"`
+	Density         float64           `json:"density"`
+}
+
+// PolicyAreaCount is the number of bills of a policy area
+type PolicyAreaCount struct {
+	PolicyArea string `json:"policyArea"`
+	Count      int    `json:"count"`
+}
+
+// Page selects a slice of sorted query results and the fields loaded for each
+// Sort lists field names in priority order, prefixed with - to sort descending
+// A zero Limit returns every result after Offset and empty Fields load whole documents
+type Page struct {
+	Offset int64
+	Limit  int64
+	Sort   []string
+	Fields []string
+}
+
+// Window bounds a query to cosponsorships dated within [From, To]
+// A zero From or To leaves that side of the window open
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// IsZero reports whether the window is unbounded
+func (w Window) IsZero() bool {
+	return w.From.IsZero() && w.To.IsZero()
+}
+
+// Contains reports whether t falls inside the window
+func (w Window) Contains(t time.Time) bool {
+	if !w.From.IsZero() && t.Before(w.From) {
+		return false
+	}
+	if !w.To.IsZero() && t.After(w.To) {
+		return false
+	}
+	return true
 }
 
 // PolicyArea describes a policy area category on a bill
 type PolicyArea struct {
-	PolicyArea  string `json:"policyArea" bson:"policyArea"`
-	BillNumbers []int  `json:"billNumbers" bson:"billNumbers"`
+	Congress   int      `json:"congress" bson:"congress"`
+	PolicyArea string   `json:"policyArea" bson:"policyArea"`
+	BillIDs    []string `json:"billIds" bson:"billIds"`
 }
 
 // Subject describes a subject category on a bill
 type Subject struct {
-	Subject     string `json:"subject" bson:"subject"`
-	BillNumbers []int  `json:"billNumbers" bson:"billNumbers"`
+	Congress int      `json:"congress" bson:"congress"`
+	Subject  string   `json:"subject" bson:"subject"`
+	BillIDs  []string `json:"billIds" bson:"billIds"`
+}
+
+// Searchable bill fields
+const (
+	FieldTitle    = "title"
+	FieldSummary  = "summary"
+	FieldSubjects = "subjects"
+)
+
+// SearchTerm lists where a stemmed search term occurs in the bills of a congress
+type SearchTerm struct {
+	Congress int       `json:"congress" bson:"congress"`
+	Term     string    `json:"term" bson:"term"`
+	Postings []Posting `json:"postings" bson:"postings"`
+}
+
+// Posting records the token positions of a term in one field of a bill
+// Length is the number of tokens in the field, used to normalize relevance scores
+type Posting struct {
+	BillID    string `json:"billId" bson:"billId"`
+	Field     string `json:"field" bson:"field"`
+	Positions []int  `json:"positions" bson:"positions"`
+	Length    int    `json:"length" bson:"length"`
+}
+
+// CellBuild records what the cells stage has built for a congress: the edge kinds of its cells and
+// whether its directed edges exist, which an empty matrix or network cannot tell apart from unbuilt ones
+type CellBuild struct {
+	Congress int      `json:"congress" bson:"congress"`
+	Kinds    []string `json:"kinds" bson:"kinds"`
+	Edges    bool     `json:"edges" bson:"edges"`
+}
+
+// SearchStats holds the number of indexed bills of a congress and the total token length of each field
+type SearchStats struct {
+	Congress int            `json:"congress" bson:"congress"`
+	Bills    int            `json:"bills" bson:"bills"`
+	Lengths  map[string]int `json:"lengths" bson:"lengths"`
 }
@@ -5,49 +5,135 @@ import (
 	"fmt"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var client *mongo.Client
-var (
-	billsCollection       *mongo.Collection
-	membersCollection     *mongo.Collection
-	cellsCollection       *mongo.Collection
-	policyAreasCollection *mongo.Collection
-	subjectsCollection    *mongo.Collection
-)
+func ctx() context.Context {
+	return context.Background()
+}
 
-// Connect establishes the database connection
-func Connect() (err error) {
-	uri := "mongodb://localhost:27017"
-	client, err = mongo.NewClient(options.Client().ApplyURI(uri))
+// ConnectMongo establishes the connection to the named Mongo database
+func ConnectMongo(uri, name string) (Store, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	c, cancel := context.WithTimeout(ctx(), 5*time.Second)
 	defer cancel()
-	err = client.Connect(ctx)
+	if err := client.Connect(c); err != nil {
+		return nil, err
+	}
+	if err := client.Ping(c, nil); err != nil {
+		client.Disconnect(ctx())
+		return nil, err
+	}
+	db := client.Database(name)
+
+	fmt.Printf("Connected to Mongo database %s...\n", name)
+
+	return newStore(func(name string) collection {
+		return mongoCollection{db.Collection(name)}
+	}, nil, func() {
+		client.Disconnect(ctx())
+		fmt.Println("Disconnected from Mongo...")
+	}), nil
+}
+
+// mongoCollection adapts a Mongo collection to the collection interface
+type mongoCollection struct {
+	c *mongo.Collection
+}
+
+func (m mongoCollection) drop() error {
+	return m.c.Drop(ctx())
+}
+
+func (m mongoCollection) createIndexes(models []mongo.IndexModel) error {
+	_, err := m.c.Indexes().CreateMany(ctx(), models)
+	return err
+}
+
+func (m mongoCollection) insertMany(docs []interface{}) error {
+	_, err := m.c.InsertMany(ctx(), docs)
+	return err
+}
+
+func (m mongoCollection) find(filter bson.M, opts *options.FindOptions, results interface{}) error {
+	if opts == nil {
+		opts = options.Find()
+	}
+	cur, err := m.c.Find(ctx(), filter, opts)
 	if err != nil {
-		return
+		return err
 	}
-	err = client.Ping(ctx, nil)
+	defer cur.Close(ctx())
+	return cur.All(ctx(), results)
+}
+
+// each calls fn with a decoder for every document of the cursor in turn, stopping at fn's first error
+func (m mongoCollection) each(filter bson.M, opts *options.FindOptions, fn func(decode func(v interface{}) error) error) error {
+	if opts == nil {
+		opts = options.Find()
+	}
+	cur, err := m.c.Find(ctx(), filter, opts)
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	defer cur.Close(ctx())
+	for cur.Next(ctx()) {
+		if err := fn(cur.Decode); err != nil {
+			return err
+		}
 	}
-	billsCollection = client.Database("cosign").Collection("bills")
-	membersCollection = client.Database("cosign").Collection("members")
-	cellsCollection = client.Database("cosign").Collection("cells")
-	policyAreasCollection = client.Database("cosign").Collection("policyAreas")
-	subjectsCollection = client.Database("cosign").Collection("subjects")
+	return cur.Err()
+}
 
-	fmt.Println("Connected to Mongo...")
+func (m mongoCollection) findOne(filter bson.M, result interface{}) error {
+	return m.c.FindOne(ctx(), filter).Decode(result)
+}
 
-	return
+func (m mongoCollection) distinct(field string, filter bson.M) ([]interface{}, error) {
+	return m.c.Distinct(ctx(), field, filter)
 }
 
-// Disconnect tears down the database connection
-func Disconnect() {
-	client.Disconnect(context.Background())
-	fmt.Println("Disconnected from Mongo...")
+func (m mongoCollection) count(filter bson.M) (int64, error) {
+	return m.c.CountDocuments(ctx(), filter)
+}
+
+func (m mongoCollection) updateOne(filter, update bson.M, upsert bool) error {
+	_, err := m.c.UpdateOne(ctx(), filter, update, options.Update().SetUpsert(upsert))
+	return err
+}
+
+func (m mongoCollection) updateMany(filter, update bson.M, upsert bool) error {
+	_, err := m.c.UpdateMany(ctx(), filter, update, options.Update().SetUpsert(upsert))
+	return err
+}
+
+func (m mongoCollection) replaceOne(filter bson.M, replacement interface{}, upsert bool) error {
+	_, err := m.c.ReplaceOne(ctx(), filter, replacement, options.Replace().SetUpsert(upsert))
+	return err
+}
+
+func (m mongoCollection) deleteMany(filter bson.M) error {
+	_, err := m.c.DeleteMany(ctx(), filter)
+	return err
+}
+
+func (m mongoCollection) bulkWrite(writes []write) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(writes))
+	for i, w := range writes {
+		if w.replacement == nil {
+			models[i] = mongo.NewDeleteManyModel().SetFilter(w.filter)
+			continue
+		}
+		models[i] = mongo.NewReplaceOneModel().SetFilter(w.filter).SetReplacement(w.replacement).SetUpsert(true)
+	}
+	_, err := m.c.BulkWrite(ctx(), models, options.BulkWrite().SetOrdered(false))
+	return err
 }
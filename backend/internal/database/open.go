@@ -0,0 +1,19 @@
+package database
+
+import (
+	"backend/internal/config"
+	"fmt"
+)
+
+// Open returns the store selected by the configuration
+func Open(cfg config.Config) (Store, error) {
+	switch cfg.Store {
+	case "mongo":
+		return ConnectMongo(cfg.MongoURI, cfg.Database)
+	case "bolt":
+		return OpenBolt(cfg.Path)
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown store %q", cfg.Store)
+}
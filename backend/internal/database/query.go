@@ -0,0 +1,576 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// This file evaluates the subset of Mongo filter, update, sort and projection syntax the
+// store uses so that backends without a query engine can share the store's logic
+
+// normalize round trips v through BSON so Go values (ints, times, structs, typed slices)
+// take the same primitive forms as stored documents
+func normalize(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	bs, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	err = bson.Unmarshal(bs, &m)
+	return m, err
+}
+
+// decode unmarshals a stored document into v
+func decode(doc bson.M, v interface{}) error {
+	bs, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(bs, v)
+}
+
+// lookup resolves a dotted path, descending into arrays of documents as Mongo does
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case primitive.M:
+		child, ok := t[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookup(child, path[1:])
+	case primitive.A:
+		values := []interface{}{}
+		for _, e := range t {
+			if _, ok := e.(primitive.M); ok {
+				values = append(values, lookup(e, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// expand adds the elements of array values so conditions can match any element
+func expand(values []interface{}) []interface{} {
+	expanded := []interface{}{}
+	for _, v := range values {
+		expanded = append(expanded, v)
+		if a, ok := v.(primitive.A); ok {
+			expanded = append(expanded, a...)
+		}
+	}
+	return expanded
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compare orders two values of the same kind, reporting false when they are not comparable
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isOperatorDoc(v interface{}) bool {
+	m, ok := v.(primitive.M)
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether a normalized document satisfies a normalized filter
+func matches(doc primitive.M, filter primitive.M) (bool, error) {
+	for key, cond := range filter {
+		switch key {
+		case "$or", "$and", "$nor":
+			clauses, ok := cond.(primitive.A)
+			if !ok {
+				return false, fmt.Errorf("%s requires an array", key)
+			}
+			matched := 0
+			for _, clause := range clauses {
+				m, ok := clause.(primitive.M)
+				if !ok {
+					return false, fmt.Errorf("%s clauses must be documents", key)
+				}
+				ok, err := matches(doc, m)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					matched++
+				}
+			}
+			if key == "$or" && matched == 0 ||
+				key == "$and" && matched != len(clauses) ||
+				key == "$nor" && matched > 0 {
+				return false, nil
+			}
+		default:
+			ok, err := matchCondition(lookup(doc, strings.Split(key, ".")), cond)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchCondition(values []interface{}, cond interface{}) (bool, error) {
+	if re, ok := cond.(primitive.Regex); ok {
+		return matchOperator(values, "$regex", re, nil)
+	}
+	if !isOperatorDoc(cond) {
+		return matchEqual(values, cond), nil
+	}
+	ops := cond.(primitive.M)
+	for op, arg := range ops {
+		ok, err := matchOperator(values, op, arg, ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchEqual(values []interface{}, v interface{}) bool {
+	if len(values) == 0 {
+		return v == nil
+	}
+	for _, candidate := range expand(values) {
+		if equal(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperator(values []interface{}, op string, arg interface{}, ops primitive.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEqual(values, arg), nil
+	case "$ne":
+		return !matchEqual(values, arg), nil
+	case "$in", "$nin":
+		list, ok := arg.(primitive.A)
+		if !ok {
+			return false, fmt.Errorf("%s requires an array", op)
+		}
+		found := false
+		for _, v := range list {
+			if matchEqual(values, v) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$exists":
+		want, _ := arg.(bool)
+		return (len(values) > 0) == want, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			c, ok := compare(v, arg)
+			if !ok {
+				continue
+			}
+			if op == "$gt" && c > 0 || op == "$gte" && c >= 0 || op == "$lt" && c < 0 || op == "$lte" && c <= 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$size":
+		n, ok := number(arg)
+		if !ok {
+			return false, fmt.Errorf("$size requires a number")
+		}
+		for _, v := range values {
+			if a, ok := v.(primitive.A); ok && float64(len(a)) == n {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := arg.(primitive.A)
+		if !ok {
+			return false, fmt.Errorf("$all requires an array")
+		}
+		for _, v := range list {
+			if !matchEqual(values, v) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		sub, ok := arg.(primitive.M)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch requires a document")
+		}
+		for _, v := range values {
+			a, ok := v.(primitive.A)
+			if !ok {
+				continue
+			}
+			for _, e := range a {
+				m, ok := e.(primitive.M)
+				if !ok {
+					continue
+				}
+				if ok, err := matches(m, sub); err != nil || ok {
+					return ok, err
+				}
+			}
+		}
+		return false, nil
+	case "$regex":
+		re, err := compileRegex(arg, ops["$options"])
+		if err != nil {
+			return false, err
+		}
+		for _, v := range expand(values) {
+			if s, ok := v.(string); ok && re.MatchString(s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$options":
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported query operator %s", op)
+}
+
+func compileRegex(arg, options interface{}) (*regexp.Regexp, error) {
+	pattern, flags := "", ""
+	switch r := arg.(type) {
+	case primitive.Regex:
+		pattern, flags = r.Pattern, r.Options
+	case string:
+		pattern = r
+		flags, _ = options.(string)
+	default:
+		return nil, fmt.Errorf("$regex requires a string or regex")
+	}
+	prefix := ""
+	for _, f := range flags {
+		if strings.ContainsRune("ims", f) {
+			prefix += string(f)
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// setPath assigns a dotted path, creating intermediate documents
+func setPath(doc primitive.M, path []string, v interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := doc[key].(primitive.M)
+		if !ok {
+			child = primitive.M{}
+			doc[key] = child
+		}
+		doc = child
+	}
+	doc[path[len(path)-1]] = v
+}
+
+func unsetPath(doc primitive.M, path []string) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := doc[key].(primitive.M)
+		if !ok {
+			return
+		}
+		doc = child
+	}
+	delete(doc, path[len(path)-1])
+}
+
+func getPath(doc primitive.M, path []string) (interface{}, bool) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := doc[key].(primitive.M)
+		if !ok {
+			return nil, false
+		}
+		doc = child
+	}
+	v, ok := doc[path[len(path)-1]]
+	return v, ok
+}
+
+func add(a, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+	switch x := a.(type) {
+	case int32:
+		switch y := b.(type) {
+		case int32:
+			sum := int64(x) + int64(y)
+			if sum == int64(int32(sum)) {
+				return int32(sum), nil
+			}
+			return sum, nil
+		case int64:
+			return int64(x) + y, nil
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x + int64(y), nil
+		case int64:
+			return x + y, nil
+		}
+	}
+	x, ok := number(a)
+	y, ok2 := number(b)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("$inc requires numbers")
+	}
+	return x + y, nil
+}
+
+// eachValues reads the values of a $push or $addToSet argument, honoring $each
+func eachValues(arg interface{}) []interface{} {
+	if m, ok := arg.(primitive.M); ok {
+		if each, ok := m["$each"].(primitive.A); ok {
+			return each
+		}
+	}
+	return []interface{}{arg}
+}
+
+// applyUpdate applies a normalized update document in place
+func applyUpdate(doc primitive.M, update primitive.M, inserting bool) error {
+	for op, arg := range update {
+		fields, ok := arg.(primitive.M)
+		if !ok {
+			return fmt.Errorf("%s requires a document", op)
+		}
+		for key, v := range fields {
+			path := strings.Split(key, ".")
+			switch op {
+			case "$set":
+				setPath(doc, path, v)
+			case "$setOnInsert":
+				if inserting {
+					setPath(doc, path, v)
+				}
+			case "$unset":
+				unsetPath(doc, path)
+			case "$inc":
+				current, _ := getPath(doc, path)
+				sum, err := add(current, v)
+				if err != nil {
+					return err
+				}
+				setPath(doc, path, sum)
+			case "$push", "$addToSet":
+				current, _ := getPath(doc, path)
+				array, _ := current.(primitive.A)
+				for _, e := range eachValues(v) {
+					if op == "$addToSet" && matchEqual([]interface{}{array}, e) {
+						continue
+					}
+					array = append(array, e)
+				}
+				if array == nil {
+					array = primitive.A{}
+				}
+				setPath(doc, path, array)
+			case "$pull":
+				current, _ := getPath(doc, path)
+				array, ok := current.(primitive.A)
+				if !ok {
+					continue
+				}
+				kept := primitive.A{}
+				for _, e := range array {
+					if !equal(e, v) {
+						kept = append(kept, e)
+					}
+				}
+				setPath(doc, path, kept)
+			default:
+				return fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return nil
+}
+
+// upsertDocument seeds a new document from the equality clauses of a filter
+func upsertDocument(filter primitive.M) primitive.M {
+	doc := primitive.M{}
+	for key, cond := range filter {
+		if strings.HasPrefix(key, "$") || isOperatorDoc(cond) {
+			continue
+		}
+		setPath(doc, strings.Split(key, "."), cond)
+	}
+	return doc
+}
+
+// sortKeys reads a sort specification as ordered (field, direction) pairs
+func sortKeys(spec interface{}) []bson.E {
+	switch s := spec.(type) {
+	case bson.D:
+		return s
+	case bson.M:
+		keys := []bson.E{}
+		for k, v := range s {
+			keys = append(keys, bson.E{Key: k, Value: v})
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+		return keys
+	}
+	return nil
+}
+
+// sortDocuments orders documents by a sort specification, missing values first
+func sortDocuments(docs []primitive.M, spec interface{}) {
+	keys := sortKeys(spec)
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			path := strings.Split(key.Key, ".")
+			a, aok := getPath(docs[i], path)
+			b, bok := getPath(docs[j], path)
+			direction, _ := number(key.Value)
+			if direction == 0 {
+				direction = 1
+			}
+			if aok != bok {
+				return (!aok) == (direction > 0)
+			}
+			c, ok := compare(a, b)
+			if !ok || c == 0 {
+				continue
+			}
+			return (c < 0) == (direction > 0)
+		}
+		return false
+	})
+}
+
+// project applies an inclusion or exclusion projection to a copy of doc
+// As in Mongo, an inclusion keeps _id unless the projection excludes it
+func project(doc primitive.M, spec interface{}) primitive.M {
+	fields, err := normalize(spec)
+	if err != nil || len(fields) == 0 {
+		return doc
+	}
+	include := false
+	for k, v := range fields {
+		if n, ok := number(v); k != "_id" && (ok && n != 0 || v == true) {
+			include = true
+		}
+	}
+	projected := primitive.M{}
+	if include {
+		if _, ok := fields["_id"]; !ok {
+			fields["_id"] = 1
+		}
+		for k, v := range fields {
+			if n, ok := number(v); ok && n == 0 || v == false {
+				continue
+			}
+			path := strings.Split(k, ".")
+			if v, ok := getPath(doc, path); ok {
+				setPath(projected, path, v)
+			}
+		}
+		return projected
+	}
+	for k, v := range doc {
+		projected[k] = v
+	}
+	for k := range fields {
+		unsetPath(projected, strings.Split(k, "."))
+	}
+	return projected
+}
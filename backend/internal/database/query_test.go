@@ -0,0 +1,357 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func seed(t *testing.T, docs ...bson.M) *memoryCollection {
+	t.Helper()
+	c := &memoryCollection{}
+	in := make([]interface{}, len(docs))
+	for i, d := range docs {
+		in[i] = d
+	}
+	if err := c.insertMany(in); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// ids lists the _id of each document found, in result order
+func ids(t *testing.T, c *memoryCollection, filter bson.M, opts *options.FindOptions) string {
+	t.Helper()
+	var docs []bson.M
+	if err := c.find(filter, opts, &docs); err != nil {
+		t.Fatalf("find %v: %v", filter, err)
+	}
+	out := []string{}
+	for _, d := range docs {
+		out = append(out, d["_id"].(string))
+	}
+	return strings.Join(out, ",")
+}
+
+func queryFixture(t *testing.T) *memoryCollection {
+	return seed(t,
+		bson.M{"_id": "a", "n": 1, "name": "Alpha", "tags": []string{"x", "y"}, "sub": bson.M{"k": "v"},
+			"items": []bson.M{{"p": 1, "q": "m"}, {"p": 2, "q": "n"}}},
+		bson.M{"_id": "b", "n": 2, "name": "beta", "tags": []string{"y"},
+			"items": []bson.M{{"p": 1, "q": "n"}}},
+		bson.M{"_id": "c", "n": 3, "tags": []string{}, "flag": nil},
+	)
+}
+
+func TestQueryOperators(t *testing.T) {
+	c := queryFixture(t)
+	for _, test := range []struct {
+		name   string
+		filter bson.M
+		want   string
+	}{
+		{"empty", bson.M{}, "a,b,c"},
+		{"equality", bson.M{"n": 2}, "b"},
+		{"numeric kinds compare equal", bson.M{"n": 2.0}, "b"},
+		{"array contains", bson.M{"tags": "y"}, "a,b"},
+		{"whole array", bson.M{"tags": []string{"y"}}, "b"},
+		{"dotted path", bson.M{"sub.k": "v"}, "a"},
+		{"dotted path into array", bson.M{"items.p": 2}, "a"},
+		{"null matches missing and null", bson.M{"name": nil}, "c"},
+		{"$eq", bson.M{"n": bson.M{"$eq": 1}}, "a"},
+		{"$ne", bson.M{"n": bson.M{"$ne": 2}}, "a,c"},
+		{"$ne against array elements", bson.M{"tags": bson.M{"$ne": "y"}}, "c"},
+		{"$gt", bson.M{"n": bson.M{"$gt": 1}}, "b,c"},
+		{"$gte and $lt", bson.M{"n": bson.M{"$gte": 2, "$lt": 3}}, "b"},
+		{"$lte", bson.M{"n": bson.M{"$lte": 1}}, "a"},
+		{"range skips other kinds", bson.M{"name": bson.M{"$gt": 0}}, ""},
+		{"string range", bson.M{"name": bson.M{"$gte": "B"}}, "b"},
+		{"$in", bson.M{"tags": bson.M{"$in": []string{"x", "z"}}}, "a"},
+		{"$in with null", bson.M{"name": bson.M{"$in": []interface{}{nil, "beta"}}}, "b,c"},
+		{"$nin", bson.M{"tags": bson.M{"$nin": []string{"x"}}}, "b,c"},
+		{"$nin matches missing", bson.M{"name": bson.M{"$nin": []string{"Alpha"}}}, "b,c"},
+		{"$exists", bson.M{"sub": bson.M{"$exists": true}}, "a"},
+		{"$exists false", bson.M{"sub": bson.M{"$exists": false}}, "b,c"},
+		{"$exists with null value", bson.M{"flag": bson.M{"$exists": true}}, "c"},
+		{"$size", bson.M{"tags": bson.M{"$size": 0}}, "c"},
+		{"$size two", bson.M{"tags": bson.M{"$size": 2}}, "a"},
+		{"$all", bson.M{"tags": bson.M{"$all": []string{"x", "y"}}}, "a"},
+		{"$all one", bson.M{"tags": bson.M{"$all": []string{"y"}}}, "a,b"},
+		{"$elemMatch", bson.M{"items": bson.M{"$elemMatch": bson.M{"p": 1, "q": "n"}}}, "b"},
+		{"dotted paths match across elements", bson.M{"items.p": 1, "items.q": "n"}, "a,b"},
+		{"$elemMatch with operators", bson.M{"items": bson.M{"$elemMatch": bson.M{"p": bson.M{"$gt": 1}}}}, "a"},
+		{"$regex", bson.M{"name": bson.M{"$regex": "^b"}}, "b"},
+		{"$regex is case sensitive", bson.M{"name": bson.M{"$regex": "^a"}}, ""},
+		{"$regex with $options", bson.M{"name": bson.M{"$regex": "^a", "$options": "i"}}, "a"},
+		{"regex value", bson.M{"name": primitive.Regex{Pattern: "^A", Options: ""}}, "a"},
+		{"regex value with options", bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: "ALPHA", Options: "i"}}}, "a"},
+		{"$regex over array elements", bson.M{"tags": bson.M{"$regex": "^x"}}, "a"},
+		{"$and", bson.M{"$and": []bson.M{{"n": bson.M{"$gte": 2}}, {"tags": "y"}}}, "b"},
+		{"$and on one field", bson.M{"$and": []bson.M{{"n": bson.M{"$gt": 1}}, {"n": bson.M{"$lt": 3}}}}, "b"},
+		{"$or", bson.M{"$or": []bson.M{{"n": 1}, {"tags": bson.M{"$size": 0}}}}, "a,c"},
+		{"$nor", bson.M{"$nor": []bson.M{{"n": 1}, {"tags": "y"}}}, "c"},
+		{"$or with field", bson.M{"tags": "y", "$or": []bson.M{{"n": 2}, {"n": 3}}}, "b"},
+		{"nested logic", bson.M{"$or": []bson.M{{"$and": []bson.M{{"n": 1}, {"sub.k": "v"}}}, {"name": "beta"}}}, "a,b"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ids(t, c, test.filter, nil); got != test.want {
+				t.Errorf("%v matched %q, want %q", test.filter, got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	c := queryFixture(t)
+	for _, filter := range []bson.M{
+		{"n": bson.M{"$where": "true"}},
+		{"n": bson.M{"$in": 1}},
+		{"$or": bson.M{"n": 1}},
+		{"$and": []int{1}},
+		{"tags": bson.M{"$size": "two"}},
+		{"tags": bson.M{"$all": "x"}},
+		{"items": bson.M{"$elemMatch": 1}},
+		{"name": bson.M{"$regex": 1}},
+		{"name": bson.M{"$regex": "("}},
+	} {
+		var docs []bson.M
+		if err := c.find(filter, nil, &docs); err == nil {
+			t.Errorf("%v did not fail", filter)
+		}
+	}
+}
+
+func TestUpdateOperators(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		update bson.M
+		want   bson.M
+	}{
+		{"$set", bson.M{"$set": bson.M{"n": 5, "name": "x"}},
+			bson.M{"_id": "a", "n": int32(5), "name": "x", "tags": primitive.A{"x"}}},
+		{"$set creates documents", bson.M{"$set": bson.M{"sub.k": true}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x"}, "sub": bson.M{"k": true}}},
+		{"$unset", bson.M{"$unset": bson.M{"n": "", "missing.path": ""}},
+			bson.M{"_id": "a", "tags": primitive.A{"x"}}},
+		{"$inc", bson.M{"$inc": bson.M{"n": 2}},
+			bson.M{"_id": "a", "n": int32(3), "tags": primitive.A{"x"}}},
+		{"$inc widens", bson.M{"$inc": bson.M{"n": int64(1) << 40}},
+			bson.M{"_id": "a", "n": int64(1)<<40 + 1, "tags": primitive.A{"x"}}},
+		{"$inc float", bson.M{"$inc": bson.M{"n": 0.5}},
+			bson.M{"_id": "a", "n": 1.5, "tags": primitive.A{"x"}}},
+		{"$inc missing", bson.M{"$inc": bson.M{"m": -1}},
+			bson.M{"_id": "a", "n": int32(1), "m": int32(-1), "tags": primitive.A{"x"}}},
+		{"$push", bson.M{"$push": bson.M{"tags": "x"}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x", "x"}}},
+		{"$push $each", bson.M{"$push": bson.M{"tags": bson.M{"$each": []string{"y", "z"}}}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x", "y", "z"}}},
+		{"$push missing", bson.M{"$push": bson.M{"other": 1}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x"}, "other": primitive.A{int32(1)}}},
+		{"$addToSet", bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": []string{"x", "y", "y"}}}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x", "y"}}},
+		{"$pull", bson.M{"$pull": bson.M{"tags": "x"}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{}}},
+		{"$setOnInsert ignored on update", bson.M{"$setOnInsert": bson.M{"n": 9}},
+			bson.M{"_id": "a", "n": int32(1), "tags": primitive.A{"x"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := seed(t, bson.M{"_id": "a", "n": 1, "tags": []string{"x"}})
+			if err := c.updateOne(bson.M{"_id": "a"}, test.update, false); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.docs[0], test.want) {
+				t.Errorf("updated to %v, want %v", c.docs[0], test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateMatching(t *testing.T) {
+	c := queryFixture(t)
+	if err := c.updateOne(bson.M{"tags": "y"}, bson.M{"$set": bson.M{"one": true}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{"one": true}, nil); got != "a" {
+		t.Errorf("updateOne changed %q", got)
+	}
+	if err := c.updateMany(bson.M{"tags": "y"}, bson.M{"$set": bson.M{"many": true}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{"many": true}, nil); got != "a,b" {
+		t.Errorf("updateMany changed %q", got)
+	}
+	if err := c.updateOne(bson.M{"_id": "z"}, bson.M{"$set": bson.M{"n": 1}}, false); err != nil || len(c.docs) != 3 {
+		t.Errorf("update without upsert inserted: %v", err)
+	}
+	if err := c.updateOne(bson.M{"_id": "a"}, bson.M{"$rename": bson.M{"n": "m"}}, false); err == nil {
+		t.Errorf("unsupported update operator did not fail")
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	c := queryFixture(t)
+	// the new document takes the filter's equality clauses but not its operator clauses
+	err := c.updateOne(bson.M{"_id": "z", "sub.k": "w", "n": bson.M{"$gt": 5}, "$or": []bson.M{{"x": 1}}},
+		bson.M{"$set": bson.M{"name": "zed"}, "$setOnInsert": bson.M{"created": true}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{"_id": "z", "sub": bson.M{"k": "w"}, "name": "zed", "created": true}
+	if got := c.docs[len(c.docs)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("upserted %v, want %v", got, want)
+	}
+
+	// a matching upsert updates in place and skips $setOnInsert
+	err = c.updateOne(bson.M{"_id": "b"}, bson.M{"$set": bson.M{"n": 7}, "$setOnInsert": bson.M{"created": true}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{"n": 7, "created": bson.M{"$exists": false}}, nil); got != "b" || len(c.docs) != 4 {
+		t.Errorf("matching upsert changed %q", got)
+	}
+}
+
+func TestReplaceAndDelete(t *testing.T) {
+	c := queryFixture(t)
+	if err := c.replaceOne(bson.M{"_id": "b"}, bson.M{"_id": "b", "n": 8}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.docs[1], bson.M{"_id": "b", "n": int32(8)}) {
+		t.Errorf("replaced with %v", c.docs[1])
+	}
+	if err := c.replaceOne(bson.M{"_id": "y"}, bson.M{"_id": "y"}, true); err != nil || len(c.docs) != 4 {
+		t.Errorf("replace upsert: %v", err)
+	}
+	if err := c.deleteMany(bson.M{"n": bson.M{"$gte": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{}, nil); got != "a,y" {
+		t.Errorf("left %q after delete", got)
+	}
+}
+
+func TestUniqueIndexes(t *testing.T) {
+	c := &memoryCollection{}
+	if err := c.createIndexes(indexes["members"]); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(doc bson.M) error { return c.insertMany([]interface{}{doc}) }
+	if err := insert(bson.M{"_id": "a", "congress": 116, "bioguideId": "A1", "id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert(bson.M{"_id": "b", "congress": 116, "bioguideId": "B1", "id": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert(bson.M{"_id": "c", "congress": 116, "bioguideId": "A1", "id": 3}); err == nil || !strings.HasPrefix(err.Error(), "duplicate key") {
+		t.Errorf("duplicate insert returned %v", err)
+	}
+	if err := insert(bson.M{"_id": "c", "congress": 117, "bioguideId": "A1", "id": 1}); err != nil {
+		t.Errorf("insert in another congress: %v", err)
+	}
+
+	// lookups through the index still apply the rest of the filter
+	if got := ids(t, c, bson.M{"congress": 116, "bioguideId": "A1"}, nil); got != "a" {
+		t.Errorf("index lookup found %q", got)
+	}
+	if got := ids(t, c, bson.M{"congress": 116.0, "bioguideId": "A1", "id": 2}, nil); got != "" {
+		t.Errorf("index lookup ignored a clause: %q", got)
+	}
+
+	if err := c.updateOne(bson.M{"_id": "b"}, bson.M{"$set": bson.M{"bioguideId": "A1"}}, false); err == nil || !strings.HasPrefix(err.Error(), "duplicate key") {
+		t.Errorf("duplicate update returned %v", err)
+	}
+	if got := ids(t, c, bson.M{"bioguideId": "B1"}, nil); got != "b" {
+		t.Errorf("failed update changed the document: %q", got)
+	}
+	if err := c.updateOne(bson.M{"_id": "b"}, bson.M{"$set": bson.M{"bioguideId": "B2"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{"congress": 116, "bioguideId": "B2"}, nil); got != "b" {
+		t.Errorf("index not updated: %q", got)
+	}
+	if err := c.deleteMany(bson.M{"_id": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(t, c, bson.M{"congress": 116, "bioguideId": "B2"}, nil); got != "b" {
+		t.Errorf("index not rebuilt after delete: %q", got)
+	}
+}
+
+func TestSort(t *testing.T) {
+	c := seed(t,
+		bson.M{"_id": "a", "n": 2, "s": "x"},
+		bson.M{"_id": "b", "s": "y"},
+		bson.M{"_id": "c", "n": 1, "s": "y"},
+		bson.M{"_id": "d", "n": 2.5, "s": "x"},
+		bson.M{"_id": "e", "n": 2, "s": "y"},
+	)
+	for _, test := range []struct {
+		name string
+		opts *options.FindOptions
+		want string
+	}{
+		{"ascending, missing first", options.Find().SetSort(bson.M{"n": 1}), "b,c,a,e,d"},
+		{"descending, missing last", options.Find().SetSort(bson.M{"n": -1}), "d,a,e,c,b"},
+		{"compound", options.Find().SetSort(bson.D{{Key: "s", Value: -1}, {Key: "n", Value: -1}}), "e,c,b,d,a"},
+		{"skip and limit", options.Find().SetSort(bson.M{"n": 1}).SetSkip(1).SetLimit(2), "c,a"},
+		{"skip past the end", options.Find().SetSkip(9), ""},
+		{"zero limit is unlimited", options.Find().SetLimit(0), "a,b,c,d,e"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ids(t, c, bson.M{}, test.opts); got != test.want {
+				t.Errorf("sorted %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProjection(t *testing.T) {
+	doc := bson.M{"_id": "a", "n": int32(1), "sub": bson.M{"k": "v", "l": "w"}}
+	for _, test := range []struct {
+		name string
+		spec interface{}
+		want bson.M
+	}{
+		{"inclusion keeps _id", bson.M{"n": 1}, bson.M{"_id": "a", "n": int32(1)}},
+		{"inclusion without _id", bson.M{"n": 1, "_id": 0}, bson.M{"n": int32(1)}},
+		{"inclusion of a dotted path", bson.M{"sub.k": true}, bson.M{"_id": "a", "sub": bson.M{"k": "v"}}},
+		{"inclusion of a missing field", bson.M{"x": 1}, bson.M{"_id": "a"}},
+		{"exclusion", bson.M{"n": 0}, bson.M{"_id": "a", "sub": bson.M{"k": "v", "l": "w"}}},
+		{"exclusion of _id", bson.M{"_id": 0}, bson.M{"n": int32(1), "sub": bson.M{"k": "v", "l": "w"}}},
+		{"empty", bson.M{}, doc},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := project(doc, test.spec); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("projected %v, want %v", got, test.want)
+			}
+		})
+	}
+	if _, ok := doc["sub"].(bson.M)["k"]; !ok {
+		t.Errorf("projection changed the document")
+	}
+}
+
+func TestDistinctAndCount(t *testing.T) {
+	c := queryFixture(t)
+	values, err := c.distinct("tags", bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"x", "y"}) {
+		t.Errorf("distinct tags = %v", values)
+	}
+	values, err = c.distinct("items.p", bson.M{"n": bson.M{"$lt": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{int32(1), int32(2)}) {
+		t.Errorf("distinct items.p = %v", values)
+	}
+	if n, err := c.count(bson.M{"tags": "y"}); err != nil || n != 2 {
+		t.Errorf("count = %d, %v", n, err)
+	}
+}
@@ -1,182 +1,484 @@
 package database
 
 import (
-	"context"
+	"sort"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ctx() context.Context {
-	return context.Background()
+// ErrNoDocuments is returned when a single document lookup matches nothing
+var ErrNoDocuments = mongo.ErrNoDocuments
+
+// Store is the persistence layer shared by the parser and the API
+type Store interface {
+	Clean(dropBills, dropMembers, dropCells, dropSubjects, dropSearch bool) error
+	Flush() error
+	Disconnect()
+
+	UpsertBill(b *Bill) error
+	GetBillHashes() (map[string]bool, error)
+	MarkPending(filter bson.M, stages ...string) error
+	ClearPending(filter bson.M, stage string) error
+	UpdateBill(filter, update bson.M) error
+	GetBills(filter bson.M) ([]Bill, error)
+	GetBillsPage(filter bson.M, page Page) ([]Bill, int64, error)
+	GetCongresses() ([]int, error)
+
+	InsertMembers(ms []interface{}) error
+	GetMembers(filter bson.M) ([]Member, map[string]Member, error)
+	UpdateMember(filter, update bson.M) error
+	UpdateMembers(filter, update bson.M) error
+
+	ReplaceCells(cells []Cell) error
+	GetCell(filter bson.M, window Window) (Cell, error)
+	GetCells(congress int, filter bson.M, subjects []string, window Window) ([]Cell, error)
+	ReplaceCellBuild(build CellBuild) error
+	GetCellBuild(congress int) (CellBuild, error)
+
+	GetCommunities(congress int, filter bson.M) ([]Community, error)
+
+	ReplaceEdges(edges []Edge) error
+	GetEdge(filter bson.M, window Window) (Edge, error)
+	GetEdges(congress int, filter bson.M, window Window) ([]Edge, error)
+
+	ReplaceSubjects(subjects []Subject) error
+	ReplacePolicyAreas(policyAreas []PolicyArea) error
+	GetPolicyAreas(filter bson.M) ([]PolicyArea, error)
+	GetSubjects(filter bson.M) ([]Subject, error)
+
+	EachBill(filter bson.M, fn func(Bill) error) error
+	EachMember(filter bson.M, fn func(Member) error) error
+	EachCell(filter bson.M, subjects []string, window Window, fn func(Cell) error) error
+	EachSubject(filter bson.M, fn func(Subject) error) error
+
+	ReplaceTerms(terms []SearchTerm) error
+	GetTerms(filter bson.M) ([]SearchTerm, error)
+	ReplaceSearchStats(stats SearchStats) error
+	GetSearchStats(congress int) (SearchStats, error)
+}
+
+// collection is the set of document operations each storage backend provides
+// Filters and updates use Mongo query syntax
+type collection interface {
+	drop() error
+	createIndexes(models []mongo.IndexModel) error
+	insertMany(docs []interface{}) error
+	find(filter bson.M, opts *options.FindOptions, results interface{}) error
+	each(filter bson.M, opts *options.FindOptions, fn func(decode func(v interface{}) error) error) error
+	findOne(filter bson.M, result interface{}) error
+	distinct(field string, filter bson.M) ([]interface{}, error)
+	count(filter bson.M) (int64, error)
+	updateOne(filter, update bson.M, upsert bool) error
+	updateMany(filter, update bson.M, upsert bool) error
+	replaceOne(filter bson.M, replacement interface{}, upsert bool) error
+	deleteMany(filter bson.M) error
+	bulkWrite(writes []write) error
+}
+
+// write is one operation of a bulk write
+// A nil replacement deletes the documents matching the filter; otherwise the first match is
+// replaced, or the replacement inserted when nothing matches
+// The writes of a bulk write must target distinct documents, as they may be applied in any order
+type write struct {
+	filter      bson.M
+	replacement interface{}
+}
+
+// store implements Store over a backend's collections
+type store struct {
+	bills       collection
+	members     collection
+	cells       collection
+	cellBuilds  collection
+	edges       collection
+	policyAreas collection
+	subjects    collection
+	terms       collection
+	searchStats collection
+	flush       func() error
+	close       func()
+}
+
+// newStore builds a store whose collections are created by the backend's factory
+// flush commits buffered writes and may be nil when every write is durable once it returns
+func newStore(open func(name string) collection, flush func() error, close func()) Store {
+	return &store{
+		bills:       open("bills"),
+		members:     open("members"),
+		cells:       open("cells"),
+		cellBuilds:  open("cellBuilds"),
+		edges:       open("edges"),
+		policyAreas: open("policyAreas"),
+		subjects:    open("subjects"),
+		terms:       open("terms"),
+		searchStats: open("searchStats"),
+		flush:       flush,
+		close:       close,
+	}
 }
 
 func indexOpts() *options.IndexOptions {
 	return options.Index().SetUnique(true)
 }
 
+// compoundKeys builds an ordered ascending index key over the supplied fields
+func compoundKeys(fields ...string) bson.D {
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	return keys
+}
+
+// indexes holds the indices of each collection
+var indexes = map[string][]mongo.IndexModel{
+	"bills": {
+		{Keys: compoundKeys("congress", "type", "number"), Options: indexOpts()},
+		{Keys: compoundKeys("congress", "id"), Options: indexOpts()},
+		{Keys: bson.M{"hash": 1}},
+		{Keys: compoundKeys("congress", "pending")},
+		{Keys: bson.M{"titleLower": 1}},
+		{Keys: compoundKeys("congress", "score")},
+		{Keys: compoundKeys("congress", "numCosponsors")},
+		{Keys: compoundKeys("congress", "introduced")},
+		{Keys: bson.M{"multiParty": 1}},
+		{Keys: compoundKeys("congress", "policyArea")},
+		{Keys: bson.M{"subjects": 1}},
+		{Keys: bson.M{"sponsors.bioguideId": 1}},
+		{Keys: bson.M{"cosponsors.bioguideId": 1}},
+	},
+	"members": {
+		{Keys: compoundKeys("congress", "bioguideId"), Options: indexOpts()},
+		{Keys: compoundKeys("congress", "id"), Options: indexOpts()},
+		{Keys: compoundKeys("congress", "name")},
+		{Keys: compoundKeys("congress", "chamber")},
+		{Keys: bson.M{"bioguideId": 1}},
+		{Keys: compoundKeys("congress", "state")},
+		{Keys: bson.M{"terms.start": 1}},
+	},
+	"cells": {
+		{Keys: compoundKeys("congress", "position", "edges"), Options: indexOpts()},
+		{Keys: compoundKeys("congress", "chamber")},
+		{Keys: bson.M{"policyAreas": 1}},
+		{Keys: bson.M{"subjects": 1}},
+	},
+	"cellBuilds": {
+		{Keys: bson.M{"congress": 1}, Options: indexOpts()},
+	},
+	"edges": {
+		{Keys: compoundKeys("congress", "source", "target"), Options: indexOpts()},
+		{Keys: compoundKeys("congress", "target")},
+		{Keys: compoundKeys("congress", "chamber")},
+	},
+	"policyAreas": {
+		{Keys: compoundKeys("congress", "policyArea"), Options: indexOpts()},
+	},
+	"subjects": {
+		{Keys: compoundKeys("congress", "subject"), Options: indexOpts()},
+	},
+	"terms": {
+		{Keys: compoundKeys("congress", "term"), Options: indexOpts()},
+	},
+	"searchStats": {
+		{Keys: bson.M{"congress": 1}, Options: indexOpts()},
+	},
+}
+
+// reset drops a collection and recreates its indices
+func reset(c collection, name string) error {
+	if err := c.drop(); err != nil {
+		return err
+	}
+	return c.createIndexes(indexes[name])
+}
+
+// Flush commits the writes a backend buffers, such as the single file store's
+func (s *store) Flush() error {
+	if s.flush == nil {
+		return nil
+	}
+	return s.flush()
+}
+
+// Disconnect releases the store's resources
+func (s *store) Disconnect() {
+	if s.close != nil {
+		s.close()
+	}
+}
+
 // Clean drops collections and recreates indices
-func Clean(dropBills, dropMembers, dropCells, dropSubjects bool) error {
+// Retained bills are marked pending for each stage whose collection was dropped
+func (s *store) Clean(dropBills, dropMembers, dropCells, dropSubjects, dropSearch bool) error {
 	if dropBills {
-		if err := billsCollection.Drop(ctx()); err != nil {
-			return err
-		}
-		indices := []mongo.IndexModel{
-			{Keys: bson.M{"number": 1}, Options: indexOpts()},
-			{Keys: bson.M{"titleLower": 1}},
-			{Keys: bson.M{"hasBothParties": 1}},
-		}
-		if _, err := billsCollection.Indexes().CreateMany(ctx(), indices); err != nil {
+		if err := reset(s.bills, "bills"); err != nil {
 			return err
 		}
 	}
 
 	if dropMembers {
-		if err := membersCollection.Drop(ctx()); err != nil {
-			return err
-		}
-		indices := []mongo.IndexModel{
-			{Keys: bson.M{"id": 1}, Options: indexOpts()},
-			{Keys: bson.M{"name": 1}, Options: indexOpts()},
-		}
-		if _, err := membersCollection.Indexes().CreateMany(ctx(), indices); err != nil {
+		if err := reset(s.members, "members"); err != nil {
 			return err
 		}
 	}
 
 	if dropCells {
-		if err := cellsCollection.Drop(ctx()); err != nil {
+		if err := reset(s.cells, "cells"); err != nil {
 			return err
 		}
-		indices := []mongo.IndexModel{
-			{Keys: bson.M{"position": 1}, Options: indexOpts()},
-			{Keys: bson.M{"policyAreas": 1}},
-			{Keys: bson.M{"subjects": 1}},
+		if err := reset(s.cellBuilds, "cellBuilds"); err != nil {
+			return err
 		}
-		if _, err := cellsCollection.Indexes().CreateMany(ctx(), indices); err != nil {
+		if err := reset(s.edges, "edges"); err != nil {
 			return err
 		}
 	}
 
 	if dropSubjects {
-		if err := policyAreasCollection.Drop(ctx()); err != nil {
+		if err := reset(s.policyAreas, "policyAreas"); err != nil {
 			return err
 		}
-		indices := []mongo.IndexModel{
-			{Keys: bson.M{"policyArea": 1}, Options: indexOpts()},
+		if err := reset(s.subjects, "subjects"); err != nil {
+			return err
 		}
-		if _, err := policyAreasCollection.Indexes().CreateMany(ctx(), indices); err != nil {
+	}
+
+	if dropSearch {
+		if err := reset(s.terms, "terms"); err != nil {
 			return err
 		}
-		if err := subjectsCollection.Drop(ctx()); err != nil {
+		if err := reset(s.searchStats, "searchStats"); err != nil {
 			return err
 		}
-		indices = []mongo.IndexModel{
-			{Keys: bson.M{"subject": 1}, Options: indexOpts()},
+	}
+
+	if !dropBills {
+		dropped := map[string]bool{
+			StageMembers:  dropMembers,
+			StageCells:    dropCells,
+			StageSubjects: dropSubjects,
+			StageSearch:   dropSearch,
+		}
+		stages := []string{}
+		for _, stage := range Stages {
+			if dropped[stage] {
+				stages = append(stages, stage)
+			}
 		}
-		if _, err := subjectsCollection.Indexes().CreateMany(ctx(), indices); err != nil {
-			return err
+		if len(stages) > 0 {
+			if err := s.MarkPending(bson.M{}, stages...); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-// InsertBill inserts a bill into the database
-func InsertBill(b *Bill) error {
-	_, err := billsCollection.InsertOne(ctx(), b)
-	return err
+// UpsertBill inserts a bill or replaces the stored bill with the same congress, type and number
+func (s *store) UpsertBill(b *Bill) error {
+	filter := bson.M{
+		"congress": b.Congress,
+		"type":     b.Type,
+		"number":   b.Number,
+	}
+	return s.bills.replaceOne(filter, b, true)
 }
 
-// GetBills returns bills matching the supplied filter
-func GetBills(filter bson.M) ([]Bill, error) {
+// GetBillHashes returns the set of content hashes of every stored bill
+func (s *store) GetBillHashes() (map[string]bool, error) {
+	hashes := map[string]bool{}
 	var bills []Bill
-	cur, err := billsCollection.Find(ctx(), filter)
-	if err != nil {
-		return bills, err
+	opts := options.Find()
+	opts.SetProjection(bson.M{"hash": 1})
+	if err := s.bills.find(bson.M{}, opts, &bills); err != nil {
+		return hashes, err
+	}
+	for _, bill := range bills {
+		hashes[bill.Hash] = true
+	}
+	return hashes, nil
+}
+
+// MarkPending queues the bills matching the filter for the supplied stages
+func (s *store) MarkPending(filter bson.M, stages ...string) error {
+	update := bson.M{
+		"$addToSet": bson.M{
+			"pending": bson.M{"$each": stages},
+		},
+	}
+	return s.bills.updateMany(filter, update, false)
+}
+
+// UpdateBill updates the bill matching the filter
+func (s *store) UpdateBill(filter, update bson.M) error {
+	return s.bills.updateOne(filter, update, false)
+}
+
+// ClearPending marks a stage as complete for the bills matching the filter
+// The stage's results are flushed before the flags are cleared and the flags after, so an interrupted run
+// never leaves bills marked complete without the results it wrote
+func (s *store) ClearPending(filter bson.M, stage string) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	update := bson.M{
+		"$pull": bson.M{"pending": stage},
+	}
+	if err := s.bills.updateMany(filter, update, false); err != nil {
+		return err
 	}
-	defer cur.Close(ctx())
-	err = cur.All(ctx(), &bills)
+	return s.Flush()
+}
+
+// GetBills returns bills matching the supplied filter
+func (s *store) GetBills(filter bson.M) ([]Bill, error) {
+	var bills []Bill
+	err := s.bills.find(filter, nil, &bills)
 	return bills, err
 }
 
-// GetSponsors passes over bills collection and extracts sponsor data
-func GetSponsors() (map[string]bool, error) {
-	names := map[string]bool{}
-	opts := options.Find()
-	opts.SetProjection(bson.M{"sponsors": 1, "cosponsors": 1})
-	cur, err := billsCollection.Find(ctx(), bson.M{}, opts)
+// GetBillsPage returns one page of the bills matching the supplied filter along with the total number of matches
+// Sorting, skipping, limiting and projection are left to the backend's find options
+func (s *store) GetBillsPage(filter bson.M, page Page) ([]Bill, int64, error) {
+	total, err := s.bills.count(filter)
 	if err != nil {
-		return names, err
+		return nil, 0, err
 	}
-	defer cur.Close(ctx())
-	for cur.Next(context.Background()) {
-		var bill Bill
-		err = cur.Decode(&bill)
-		if err != nil {
-			return names, err
+	opts := options.Find().SetSkip(page.Offset)
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	if len(page.Sort) > 0 {
+		sort := bson.D{}
+		for _, field := range page.Sort {
+			if strings.HasPrefix(field, "-") {
+				sort = append(sort, bson.E{Key: field[1:], Value: -1})
+				continue
+			}
+			sort = append(sort, bson.E{Key: field, Value: 1})
+		}
+		opts.SetSort(sort)
+	}
+	if len(page.Fields) > 0 {
+		projection := bson.M{}
+		for _, field := range page.Fields {
+			projection[field] = 1
 		}
-		for _, name := range append(bill.Sponsors, bill.Cosponsors...) {
-			names[name] = true
+		opts.SetProjection(projection)
+	}
+	bills := []Bill{}
+	err = s.bills.find(filter, opts, &bills)
+	return bills, total, err
+}
+
+// GetCongresses returns the distinct congresses present in the bills collection
+func (s *store) GetCongresses() ([]int, error) {
+	congresses := []int{}
+	values, err := s.bills.distinct("congress", bson.M{})
+	if err != nil {
+		return congresses, err
+	}
+	for _, v := range values {
+		switch c := v.(type) {
+		case int32:
+			congresses = append(congresses, int(c))
+		case int64:
+			congresses = append(congresses, int(c))
 		}
 	}
-	return names, nil
+	sort.Ints(congresses)
+	return congresses, nil
 }
 
 // InsertMembers inserts a slice of members into the database
-func InsertMembers(ms []interface{}) error {
-	_, err := membersCollection.InsertMany(ctx(), ms)
-	return err
+func (s *store) InsertMembers(ms []interface{}) error {
+	return s.members.insertMany(ms)
 }
 
-// GetMembers returns all members from the database
-func GetMembers(filter bson.M) ([]Member, map[int]Member, error) {
+// GetMembers returns the members matching the filter, along with a map keyed by bioguide ID
+func (s *store) GetMembers(filter bson.M) ([]Member, map[string]Member, error) {
 	var members []Member
-	memberMap := map[int]Member{}
-	cur, err := membersCollection.Find(ctx(), filter)
-	if err != nil {
-		return members, memberMap, err
-	}
-	defer cur.Close(ctx())
-	err = cur.All(ctx(), &members)
+	memberMap := map[string]Member{}
+	err := s.members.find(filter, nil, &members)
 	for _, m := range members {
-		memberMap[m.ID] = m
+		memberMap[m.BioguideID] = m
 	}
 	return members, memberMap, err
 }
 
 // UpdateMember updates a member document
-func UpdateMember(filter, update bson.M) error {
-	_, err := membersCollection.UpdateOne(ctx(), filter, update)
-	return err
+func (s *store) UpdateMember(filter, update bson.M) error {
+	return s.members.updateOne(filter, update, false)
 }
 
-// UpsertCell upserts an adjacency cell
-func UpsertCell(filter, update bson.M) error {
-	opts := options.Update()
-	opts.SetUpsert(true)
-	_, err := cellsCollection.UpdateOne(ctx(), filter, update, opts)
-	return err
+// UpdateMembers updates every member matching the filter
+func (s *store) UpdateMembers(filter, update bson.M) error {
+	return s.members.updateMany(filter, update, false)
 }
 
-// GetCell returns a cell matching the filter
-func GetCell(filter bson.M) (Cell, error) {
-	var cell Cell
-	err := cellsCollection.FindOne(ctx(), filter).Decode(&cell)
-	if err != nil {
-		return cell, err
+// ReplaceCells writes the supplied cells in a single bulk write, replacing the stored cell of each
+// position and edge kind; cells with a zero count are deleted
+func (s *store) ReplaceCells(cells []Cell) error {
+	writes := make([]write, len(cells))
+	for i := range cells {
+		writes[i].filter = bson.M{"congress": cells[i].Congress, "position": cells[i].Position, "edges": cells[i].Edges}
+		if cells[i].Count > 0 {
+			writes[i].replacement = cells[i]
+		}
+	}
+	return s.cells.bulkWrite(writes)
+}
+
+// mergeEdges merges the cells of each position matched under several edge kinds, keeping the order
+// in which positions first appear
+func mergeEdges(cells []Cell) []Cell {
+	merged := []Cell{}
+	index := map[string]int{}
+	for _, cell := range cells {
+		if i, ok := index[cell.Position]; ok {
+			merged[i].merge(cell)
+			continue
+		}
+		if cell.BillIDs == nil {
+			cell.BillIDs = map[string]time.Time{}
+		}
+		index[cell.Position] = len(merged)
+		merged = append(merged, cell)
+	}
+	return merged
+}
+
+// GetCell returns the cell matching the filter along with its bills inside the window
+// When the filter matches the cells of several edge kinds they are merged into one
+func (s *store) GetCell(filter bson.M, window Window) (Cell, error) {
+	var cells []Cell
+	if err := s.cells.find(filter, nil, &cells); err != nil {
+		return Cell{}, err
 	}
-	billNumbers := []int{}
-	for billNumber := range cell.BillNumbers {
-		billNumbers = append(billNumbers, billNumber)
+	cells = mergeEdges(cells)
+	if len(cells) == 0 {
+		return Cell{}, ErrNoDocuments
+	}
+	cell := cells[0]
+	cell.filterBills(func(billID string, date time.Time) bool {
+		return window.Contains(date)
+	})
+	billIDs := []string{}
+	for billID := range cell.BillIDs {
+		billIDs = append(billIDs, billID)
 	}
 	billsFilter := bson.M{
-		"number": bson.M{
-			"$in": billNumbers,
+		"congress": cell.Congress,
+		"id": bson.M{
+			"$in": billIDs,
 		},
 	}
-	bills, err := GetBills(billsFilter)
+	bills, err := s.GetBills(billsFilter)
 	if err != nil {
 		return cell, err
 	}
@@ -184,89 +486,369 @@ func GetCell(filter bson.M) (Cell, error) {
 	return cell, err
 }
 
-// GetCells returns cells matching the supplied filter
+// GetCells returns a congress's cells matching the supplied filter, merging the edge kinds of each position
 // Will remove any bills that do not correspond to one of the supplied subjects
-func GetCells(filter bson.M, subjects []string) ([]Cell, error) {
+// or whose cosponsorship falls outside the window, recomputing each cell's count
+func (s *store) GetCells(congress int, filter bson.M, subjects []string, window Window) ([]Cell, error) {
 	var cells []Cell
-	cur, err := cellsCollection.Find(ctx(), filter)
-	if err != nil {
+	filter = bson.M{"$and": []bson.M{filter, {"congress": congress}}}
+	if err := s.cells.find(filter, nil, &cells); err != nil {
 		return cells, err
 	}
-	defer cur.Close(ctx())
-	err = cur.All(ctx(), &cells)
+	cells = mergeEdges(cells)
 
-	if subjects == nil {
-		return cells, err
+	if subjects == nil && window.IsZero() {
+		return cells, nil
 	}
 
-	subjectsFilter := bson.M{
-		"subject": bson.M{
-			"$in": subjects,
-		},
+	var billIDSet map[string]bool
+	if subjects != nil {
+		subjectsFilter := bson.M{
+			"congress": congress,
+			"subject": bson.M{
+				"$in": subjects,
+			},
+		}
+		subjectDocuments, err := s.GetSubjects(subjectsFilter)
+		if err != nil {
+			return cells, err
+		}
+		billIDSet = map[string]bool{}
+		for _, subject := range subjectDocuments {
+			for _, billID := range subject.BillIDs {
+				billIDSet[billID] = true
+			}
+		}
 	}
-	subjectDocuments, err := GetSubjects(subjectsFilter)
-	if err != nil {
-		return cells, err
+
+	filtered := []Cell{}
+	for _, cell := range cells {
+		cell.filterBills(func(billID string, date time.Time) bool {
+			if billIDSet != nil && !billIDSet[billID] {
+				return false
+			}
+			return window.Contains(date)
+		})
+		if cell.Count > 0 {
+			filtered = append(filtered, cell)
+		}
 	}
-	billNumberSet := map[int]bool{}
-	for _, subject := range subjectDocuments {
-		for _, billNumber := range subject.BillNumbers {
-			billNumberSet[billNumber] = true
+	return filtered, nil
+}
+
+// ReplaceCellBuild stores the record of what the cells stage built for a congress
+func (s *store) ReplaceCellBuild(build CellBuild) error {
+	return s.cellBuilds.replaceOne(bson.M{"congress": build.Congress}, build, true)
+}
+
+// GetCellBuild returns the record of what the cells stage built for a congress, which is empty until it first runs
+func (s *store) GetCellBuild(congress int) (CellBuild, error) {
+	build := CellBuild{Congress: congress, Kinds: []string{}}
+	err := s.cellBuilds.findOne(bson.M{"congress": congress}, &build)
+	if err == ErrNoDocuments {
+		err = nil
+	}
+	return build, err
+}
+
+// topPolicyAreas is the number of policy areas listed for each community
+const topPolicyAreas = 5
+
+// GetCommunities summarizes the communities of a congress's members matching the supplied filter
+// Internal edges are the cells of any edge kind joining two members of the same community
+func (s *store) GetCommunities(congress int, filter bson.M) ([]Community, error) {
+	filter = bson.M{"$and": []bson.M{filter, {"congress": congress, "community": bson.M{"$gt": 0}}}}
+	var members []Member
+	if err := s.members.find(filter, options.Find().SetSort(bson.M{"bioguideId": 1}), &members); err != nil {
+		return nil, err
+	}
+	end := CongressEnd(congress)
+	byID := map[string]int{}
+	communities := map[int]*Community{}
+	for _, m := range members {
+		byID[m.BioguideID] = m.Community
+		c := communities[m.Community]
+		if c == nil {
+			c = &Community{Congress: congress, Community: m.Community, Chamber: m.Chamber, Members: []string{}, Parties: map[string]int{}}
+			communities[m.Community] = c
 		}
+		c.Members = append(c.Members, m.BioguideID)
+		c.Parties[m.PartyAt(end)]++
 	}
+
+	cells, err := s.GetCells(congress, bson.M{}, nil, Window{})
+	if err != nil {
+		return nil, err
+	}
+	shared := map[int]map[string]bool{}
 	for _, cell := range cells {
-		billNumbers := map[int]bool{}
-		for billNumber, _ := range cell.BillNumbers {
-			if _, ok := billNumberSet[billNumber]; ok {
-				billNumbers[billNumber] = true
+		pair := strings.Split(cell.Position, "_")
+		if len(pair) != 2 {
+			continue
+		}
+		a, ok := byID[pair[0]]
+		if !ok || a != byID[pair[1]] {
+			continue
+		}
+		c := communities[a]
+		c.InternalEdges++
+		if cell.Edges != EdgesSame {
+			c.CrossPartyEdges++
+		}
+		if shared[a] == nil {
+			shared[a] = map[string]bool{}
+		}
+		for billID := range cell.BillIDs {
+			shared[a][billID] = true
+		}
+	}
+
+	var bills []Bill
+	opts := options.Find().SetProjection(bson.M{"id": 1, "policyArea": 1})
+	if err := s.bills.find(bson.M{"congress": congress}, opts, &bills); err != nil {
+		return nil, err
+	}
+	policyAreas := map[string]string{}
+	for _, b := range bills {
+		policyAreas[b.ID] = b.PolicyArea
+	}
+
+	result := []Community{}
+	for id, c := range communities {
+		n := float64(len(c.Members))
+		if n > 1 {
+			c.Density = float64(c.InternalEdges) / (n * (n - 1) / 2)
+		}
+		counts := map[string]int{}
+		for billID := range shared[id] {
+			if area := policyAreas[billID]; area != "" {
+				counts[area]++
+			}
+		}
+		c.PolicyAreas = []PolicyAreaCount{}
+		for area, count := range counts {
+			c.PolicyAreas = append(c.PolicyAreas, PolicyAreaCount{PolicyArea: area, Count: count})
+		}
+		sort.Slice(c.PolicyAreas, func(i, j int) bool {
+			if c.PolicyAreas[i].Count != c.PolicyAreas[j].Count {
+				return c.PolicyAreas[i].Count > c.PolicyAreas[j].Count
 			}
+			return c.PolicyAreas[i].PolicyArea < c.PolicyAreas[j].PolicyArea
+		})
+		if len(c.PolicyAreas) > topPolicyAreas {
+			c.PolicyAreas = c.PolicyAreas[:topPolicyAreas]
 		}
-		cell.BillNumbers = billNumbers
-		cell.Count = len(billNumbers)
+		result = append(result, *c)
 	}
-	return cells, err
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Community < result[j].Community
+	})
+	return result, nil
 }
 
-// InsertSubject inserts a subject into the database
-func InsertSubject(subject string, billNumbers []int) error {
-	doc := bson.M{
-		"subject":     subject,
-		"billNumbers": billNumbers,
+// ReplaceEdges writes the supplied directed edges in a single bulk write, replacing the stored edge
+// between each source and target; edges with a zero count are deleted
+func (s *store) ReplaceEdges(edges []Edge) error {
+	writes := make([]write, len(edges))
+	for i := range edges {
+		writes[i].filter = bson.M{"congress": edges[i].Congress, "source": edges[i].Source, "target": edges[i].Target}
+		if edges[i].Count > 0 {
+			writes[i].replacement = edges[i]
+		}
 	}
-	_, err := subjectsCollection.InsertOne(ctx(), doc)
-	return err
+	return s.edges.bulkWrite(writes)
 }
 
-// InsertPolicyArea inserts a policy area into the database
-func InsertPolicyArea(policyArea string, billNumbers []int) error {
-	doc := bson.M{
-		"policyArea":  policyArea,
-		"billNumbers": billNumbers,
+// GetEdge returns the directed edge matching the filter along with its bills inside the window
+func (s *store) GetEdge(filter bson.M, window Window) (Edge, error) {
+	var edge Edge
+	if err := s.edges.findOne(filter, &edge); err != nil {
+		return edge, err
+	}
+	edge.filterBills(func(billID string, date time.Time) bool {
+		return window.Contains(date)
+	})
+	billIDs := []string{}
+	for billID := range edge.BillIDs {
+		billIDs = append(billIDs, billID)
 	}
-	_, err := policyAreasCollection.InsertOne(ctx(), doc)
-	return err
+	bills, err := s.GetBills(bson.M{"congress": edge.Congress, "id": bson.M{"$in": billIDs}})
+	edge.Bills = bills
+	return edge, err
 }
 
-// GetPolicyAreas returns all policy areas
-func GetPolicyAreas() ([]PolicyArea, error) {
-	var policyAreas []PolicyArea
-	cur, err := policyAreasCollection.Find(ctx(), bson.M{})
-	if err != nil {
-		return policyAreas, err
+// GetEdges returns a congress's directed edges matching the supplied filter
+// Bills joined outside the window are removed, recomputing each edge's count
+func (s *store) GetEdges(congress int, filter bson.M, window Window) ([]Edge, error) {
+	var edges []Edge
+	filter = bson.M{"$and": []bson.M{filter, {"congress": congress}}}
+	if err := s.edges.find(filter, nil, &edges); err != nil {
+		return edges, err
+	}
+	if window.IsZero() {
+		return edges, nil
 	}
-	defer cur.Close(ctx())
-	err = cur.All(ctx(), &policyAreas)
+	filtered := []Edge{}
+	for _, edge := range edges {
+		edge.filterBills(func(billID string, date time.Time) bool {
+			return window.Contains(date)
+		})
+		if edge.Count > 0 {
+			filtered = append(filtered, edge)
+		}
+	}
+	return filtered, nil
+}
+
+// ReplaceSubjects writes the supplied subjects in a single bulk write, replacing the stored subject
+// of each congress; subjects without bills are deleted
+func (s *store) ReplaceSubjects(subjects []Subject) error {
+	writes := make([]write, len(subjects))
+	for i := range subjects {
+		writes[i].filter = bson.M{"congress": subjects[i].Congress, "subject": subjects[i].Subject}
+		if len(subjects[i].BillIDs) > 0 {
+			writes[i].replacement = subjects[i]
+		}
+	}
+	return s.subjects.bulkWrite(writes)
+}
+
+// ReplacePolicyAreas writes the supplied policy areas in a single bulk write, replacing the stored
+// policy area of each congress; policy areas without bills are deleted
+func (s *store) ReplacePolicyAreas(policyAreas []PolicyArea) error {
+	writes := make([]write, len(policyAreas))
+	for i := range policyAreas {
+		writes[i].filter = bson.M{"congress": policyAreas[i].Congress, "policyArea": policyAreas[i].PolicyArea}
+		if len(policyAreas[i].BillIDs) > 0 {
+			writes[i].replacement = policyAreas[i]
+		}
+	}
+	return s.policyAreas.bulkWrite(writes)
+}
+
+// GetPolicyAreas returns all policy areas matching the supplied filter
+func (s *store) GetPolicyAreas(filter bson.M) ([]PolicyArea, error) {
+	var policyAreas []PolicyArea
+	err := s.policyAreas.find(filter, nil, &policyAreas)
 	return policyAreas, err
 }
 
 // GetSubjects returns all subjects matching the supplied filter
-func GetSubjects(filter bson.M) ([]Subject, error) {
+func (s *store) GetSubjects(filter bson.M) ([]Subject, error) {
 	var subjects []Subject
-	cur, err := subjectsCollection.Find(ctx(), filter)
-	if err != nil {
-		return subjects, err
-	}
-	defer cur.Close(ctx())
-	err = cur.All(ctx(), &subjects)
+	err := s.subjects.find(filter, nil, &subjects)
 	return subjects, err
 }
+
+// ReplaceTerms writes the supplied search terms in a single bulk write, replacing the stored
+// term of each congress; terms without postings are deleted
+func (s *store) ReplaceTerms(terms []SearchTerm) error {
+	writes := make([]write, len(terms))
+	for i := range terms {
+		writes[i].filter = bson.M{"congress": terms[i].Congress, "term": terms[i].Term}
+		if len(terms[i].Postings) > 0 {
+			writes[i].replacement = terms[i]
+		}
+	}
+	return s.terms.bulkWrite(writes)
+}
+
+// GetTerms returns all search terms matching the supplied filter
+func (s *store) GetTerms(filter bson.M) ([]SearchTerm, error) {
+	terms := []SearchTerm{}
+	err := s.terms.find(filter, nil, &terms)
+	return terms, err
+}
+
+// ReplaceSearchStats stores the search statistics of a congress
+func (s *store) ReplaceSearchStats(stats SearchStats) error {
+	return s.searchStats.replaceOne(bson.M{"congress": stats.Congress}, stats, true)
+}
+
+// GetSearchStats returns the search statistics of a congress, which are empty until its bills are indexed
+func (s *store) GetSearchStats(congress int) (SearchStats, error) {
+	stats := SearchStats{Congress: congress, Lengths: map[string]int{}}
+	err := s.searchStats.findOne(bson.M{"congress": congress}, &stats)
+	if err == ErrNoDocuments {
+		err = nil
+	}
+	return stats, err
+}
+
+// EachBill streams the bills matching the supplied filter to fn in congress, type and number order
+func (s *store) EachBill(filter bson.M, fn func(Bill) error) error {
+	opts := options.Find().SetSort(compoundKeys("congress", "type", "number"))
+	return s.bills.each(filter, opts, func(decode func(v interface{}) error) error {
+		var b Bill
+		if err := decode(&b); err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// EachMember streams the members matching the supplied filter to fn in congress and bioguide ID order
+func (s *store) EachMember(filter bson.M, fn func(Member) error) error {
+	opts := options.Find().SetSort(compoundKeys("congress", "bioguideId"))
+	return s.members.each(filter, opts, func(decode func(v interface{}) error) error {
+		var m Member
+		if err := decode(&m); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// EachCell streams the stored cells matching the supplied filter to fn in congress, position and edge kind order
+// Unlike GetCells the edge kinds of a position are not merged; as in GetCells, bills without any of the
+// subjects (when supplied) or outside the window are removed, recomputing each cell's count and weights,
+// and cells left without bills are skipped
+func (s *store) EachCell(filter bson.M, subjects []string, window Window, fn func(Cell) error) error {
+	var billIDSets map[int]map[string]bool
+	if subjects != nil {
+		subjectDocuments, err := s.GetSubjects(bson.M{"subject": bson.M{"$in": subjects}})
+		if err != nil {
+			return err
+		}
+		billIDSets = map[int]map[string]bool{}
+		for _, subject := range subjectDocuments {
+			if billIDSets[subject.Congress] == nil {
+				billIDSets[subject.Congress] = map[string]bool{}
+			}
+			for _, billID := range subject.BillIDs {
+				billIDSets[subject.Congress][billID] = true
+			}
+		}
+	}
+	opts := options.Find().SetSort(compoundKeys("congress", "position", "edges"))
+	return s.cells.each(filter, opts, func(decode func(v interface{}) error) error {
+		var c Cell
+		if err := decode(&c); err != nil {
+			return err
+		}
+		if subjects != nil || !window.IsZero() {
+			c.filterBills(func(billID string, date time.Time) bool {
+				if billIDSets != nil && !billIDSets[c.Congress][billID] {
+					return false
+				}
+				return window.Contains(date)
+			})
+			if c.Count == 0 {
+				return nil
+			}
+		}
+		return fn(c)
+	})
+}
+
+// EachSubject streams the subjects matching the supplied filter to fn in congress and subject order
+func (s *store) EachSubject(filter bson.M, fn func(Subject) error) error {
+	opts := options.Find().SetSort(compoundKeys("congress", "subject"))
+	return s.subjects.each(filter, opts, func(decode func(v interface{}) error) error {
+		var subject Subject
+		if err := decode(&subject); err != nil {
+			return err
+		}
+		return fn(subject)
+	})
+}
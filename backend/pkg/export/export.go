@@ -0,0 +1,305 @@
+// Package export streams collections as CSV, JSON Lines or Parquet for analysis outside the app
+package export
+
+import (
+	"backend/internal/database"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Formats
+const (
+	CSV     = "csv"
+	NDJSON  = "ndjson"
+	Parquet = "parquet"
+)
+
+// Formats lists every export format
+var Formats = []string{CSV, NDJSON, Parquet}
+
+// ContentTypes maps each format to its media type
+var ContentTypes = map[string]string{
+	CSV:     "text/csv",
+	NDJSON:  "application/x-ndjson",
+	Parquet: "application/vnd.apache.parquet",
+}
+
+// Collections lists every exportable collection
+var Collections = []string{"bills", "members", "cells", "subjects"}
+
+// Kinds of column values
+const (
+	kindString = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindDate
+	kindList
+)
+
+// column is a field of every row of an export
+type column struct {
+	name string
+	kind int
+}
+
+// tables lists the columns of each collection's rows
+var tables = map[string][]column{
+	"bills": {
+		{"congress", kindInt}, {"id", kindString}, {"type", kindString}, {"number", kindInt},
+		{"introduced", kindDate}, {"title", kindString}, {"sponsors", kindList}, {"sponsorIds", kindList},
+		{"cosponsorIds", kindList}, {"numCosponsors", kindInt}, {"score", kindInt}, {"numDems", kindInt},
+		{"numReps", kindInt}, {"numInds", kindInt}, {"numLibs", kindInt}, {"multiParty", kindBool},
+		{"policyArea", kindString}, {"subjects", kindList}, {"summary", kindString}, {"link", kindString},
+	},
+	"members": {
+		{"congress", kindInt}, {"bioguideId", kindString}, {"id", kindInt}, {"chamber", kindString},
+		{"name", kindString}, {"parties", kindList}, {"state", kindString}, {"districts", kindList},
+		{"gender", kindString}, {"birthday", kindDate}, {"community", kindInt}, {"degree", kindInt},
+		{"weightedDegree", kindFloat}, {"betweenness", kindFloat}, {"eigenvector", kindFloat}, {"pageRank", kindFloat},
+	},
+	"cells": {
+		{"congress", kindInt}, {"chamber", kindString}, {"position", kindString}, {"memberA", kindString},
+		{"memberB", kindString}, {"edges", kindString}, {"count", kindInt}, {"fractional", kindFloat},
+		{"pairwise", kindFloat}, {"original", kindInt}, {"billIds", kindList}, {"policyAreas", kindList},
+		{"subjects", kindList},
+	},
+	"subjects": {
+		{"congress", kindInt}, {"subject", kindString}, {"bills", kindInt}, {"billIds", kindList},
+	},
+}
+
+// listSeparator joins the items of list columns in CSV and Parquet exports
+const listSeparator = ";"
+
+func billRow(b database.Bill) []interface{} {
+	sponsorIDs := []string{}
+	for _, s := range b.Sponsors {
+		sponsorIDs = append(sponsorIDs, s.BioguideID)
+	}
+	cosponsorIDs := []string{}
+	for _, c := range b.Cosponsors {
+		if !c.Withdrawn() {
+			cosponsorIDs = append(cosponsorIDs, c.BioguideID)
+		}
+	}
+	return []interface{}{
+		b.Congress, b.ID, b.Type, b.Number, b.Introduced, b.Title, b.SponsorNames(), sponsorIDs,
+		cosponsorIDs, b.NumCosponsors, b.Score, b.NumDems, b.NumReps, b.NumInds, b.NumLibs, b.MultiParty,
+		b.PolicyArea, b.Subjects, b.Summary, b.Link,
+	}
+}
+
+func memberRow(m database.Member) []interface{} {
+	row := []interface{}{
+		m.Congress, m.BioguideID, m.ID, m.Chamber, m.Name, m.Parties, m.State, m.Districts,
+		m.Gender, nil, nil, nil, nil, nil, nil, nil,
+	}
+	if m.Birthday != nil {
+		row[9] = *m.Birthday
+	}
+	if m.Community > 0 {
+		row[10] = m.Community
+	}
+	if m.Metrics != nil {
+		copy(row[11:], []interface{}{m.Metrics.Degree, m.Metrics.WeightedDegree, m.Metrics.Betweenness,
+			m.Metrics.Eigenvector, m.Metrics.PageRank})
+	}
+	return row
+}
+
+func cellRow(c database.Cell) []interface{} {
+	members := strings.SplitN(c.Position, "_", 2)
+	if len(members) < 2 {
+		members = append(members, "")
+	}
+	billIDs := []string{}
+	for billID := range c.BillIDs {
+		billIDs = append(billIDs, billID)
+	}
+	sortBillIDs(billIDs)
+	return []interface{}{
+		c.Congress, c.Chamber, c.Position, members[0], members[1], c.Edges, c.Count, c.Weights.Fractional,
+		c.Weights.Pairwise, c.Weights.Original, billIDs, c.PolicyAreas, c.Subjects,
+	}
+}
+
+func subjectRow(s database.Subject) []interface{} {
+	billIDs := append([]string{}, s.BillIDs...)
+	sortBillIDs(billIDs)
+	return []interface{}{s.Congress, s.Subject, len(s.BillIDs), billIDs}
+}
+
+// sortBillIDs orders bill IDs by type and then number (e.g. hr2 before hr10)
+func sortBillIDs(ids []string) {
+	split := func(id string) (string, int) {
+		i := strings.IndexAny(id, "0123456789")
+		if i < 0 {
+			return id, 0
+		}
+		n, _ := strconv.Atoi(id[i:])
+		return id[:i], n
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ti, ni := split(ids[i])
+		tj, nj := split(ids[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return ni < nj
+	})
+}
+
+// rowWriter writes the rows of one export
+type rowWriter interface {
+	write(row []interface{}) error
+	close() error
+}
+
+// Filter narrows an export; Subjects and Window only apply to cells
+type Filter struct {
+	Query    bson.M
+	Subjects []string
+	Window   database.Window
+}
+
+// Export streams the collection's documents matching the filter to w in the supplied format,
+// returning the number of rows written
+func Export(store database.Store, collection, format string, filter Filter, w io.Writer) (int, error) {
+	columns, ok := tables[collection]
+	if !ok {
+		return 0, fmt.Errorf("unknown collection %q", collection)
+	}
+	var rw rowWriter
+	switch format {
+	case CSV:
+		rw = &csvWriter{w: csv.NewWriter(w), columns: columns}
+	case NDJSON:
+		rw = &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}
+	case Parquet:
+		rw = newParquetWriter(w, columns)
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+	n := 0
+	write := func(row []interface{}) error {
+		n++
+		return rw.write(row)
+	}
+	var err error
+	switch collection {
+	case "bills":
+		err = store.EachBill(filter.Query, func(b database.Bill) error { return write(billRow(b)) })
+	case "members":
+		err = store.EachMember(filter.Query, func(m database.Member) error { return write(memberRow(m)) })
+	case "cells":
+		err = store.EachCell(filter.Query, filter.Subjects, filter.Window, func(c database.Cell) error { return write(cellRow(c)) })
+	case "subjects":
+		err = store.EachSubject(filter.Query, func(s database.Subject) error { return write(subjectRow(s)) })
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, rw.close()
+}
+
+// csvWriter writes a header and then one line per row, leaving null values empty
+type csvWriter struct {
+	w       *csv.Writer
+	columns []column
+	header  bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	c.header = true
+	names := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		names[i] = col.name
+	}
+	return c.w.Write(names)
+}
+
+func (c *csvWriter) write(row []interface{}) error {
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	fields := make([]string, len(row))
+	for i, v := range row {
+		fields[i] = formatValue(v)
+	}
+	return c.w.Write(fields)
+}
+
+func (c *csvWriter) close() error {
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatValue renders a value of a CSV or Parquet string column
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, listSeparator)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format("2006-01-02")
+	}
+	return fmt.Sprint(v)
+}
+
+// ndjsonWriter writes each row as a line holding a JSON object keyed by column name, keeping lists as arrays
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []column
+}
+
+func (n *ndjsonWriter) write(row []interface{}) error {
+	n.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.Format("2006-01-02")
+		}
+		name, _ := json.Marshal(n.columns[i].name)
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.w.Write(name)
+		n.w.WriteByte(':')
+		n.w.Write(value)
+	}
+	_, err := n.w.WriteString("}\n")
+	return err
+}
+
+func (n *ndjsonWriter) close() error {
+	return n.w.Flush()
+}
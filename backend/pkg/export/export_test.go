@@ -0,0 +1,120 @@
+package export
+
+import (
+	"backend/internal/database"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestExportCSVEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := Export(database.NewMemory(), "subjects", CSV, Filter{Query: bson.M{}}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || buf.String() != "congress,subject,bills,billIds\n" {
+		t.Errorf("empty export wrote %d rows: %q", n, buf.String())
+	}
+}
+
+func TestExportBills(t *testing.T) {
+	store := database.NewMemory()
+	for _, b := range []database.Bill{
+		{Congress: 116, ID: "hr10", Type: "hr", Number: 10, Introduced: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+			Title: "Ten", Subjects: []string{"Energy", "Health"}, MultiParty: true},
+		{Congress: 116, ID: "hr2", Type: "hr", Number: 2, Title: `Two, "quoted"`},
+		{Congress: 115, ID: "hr1", Type: "hr", Number: 1, Title: "Other congress"},
+	} {
+		b := b
+		if err := store.UpsertBill(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := Filter{Query: bson.M{"congress": 116}}
+
+	var csv bytes.Buffer
+	if _, err := Export(store, "bills", CSV, filter, &csv); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("csv export = %q", csv.String())
+	}
+	if !strings.HasPrefix(lines[1], `116,hr2,hr,2,0001-01-01,"Two, ""quoted"""`) {
+		t.Errorf("first row = %q", lines[1])
+	}
+	if !strings.Contains(lines[2], ",true,,Energy;Health,") {
+		t.Errorf("second row = %q", lines[2])
+	}
+
+	var ndjson bytes.Buffer
+	if _, err := Export(store, "bills", NDJSON, filter, &ndjson); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"introduced":"2019-02-01"`) ||
+		!strings.Contains(lines[1], `"subjects":["Energy","Health"]`) {
+		t.Errorf("ndjson export = %q", ndjson.String())
+	}
+}
+
+func TestSortBillIDs(t *testing.T) {
+	ids := []string{"s1", "hr10", "hr2", "hjres3", "hr1"}
+	sortBillIDs(ids)
+	if got := strings.Join(ids, ","); got != "hjres3,hr1,hr2,hr10,s1" {
+		t.Errorf("sorted = %s", got)
+	}
+}
+
+func TestExportCellSubjects(t *testing.T) {
+	store := database.NewMemory()
+	date := time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)
+	shares := map[string]database.Share{"hr1": {Members: 2}, "hr2": {Members: 3}, "hr3": {Members: 2}, "hr4": {Members: 2}}
+	cells := []database.Cell{
+		{Congress: 116, Chamber: database.House, Position: "A000001_B000002", Edges: database.EdgesCross,
+			BillIDs: map[string]time.Time{"hr1": date, "hr2": date, "hr3": date}, Shares: shares, Subjects: []string{"Energy", "Health"}},
+		{Congress: 115, Chamber: database.House, Position: "A000001_B000002", Edges: database.EdgesCross,
+			BillIDs: map[string]time.Time{"hr1": date, "hr4": date}, Shares: shares, Subjects: []string{"Energy", "Health"}},
+	}
+	for i := range cells {
+		cells[i].Tally()
+	}
+	if err := store.ReplaceCells(cells); err != nil {
+		t.Fatal(err)
+	}
+	// bill IDs are sets per congress, so the 115th hr1 does not carry the 116th's subject
+	err := store.ReplaceSubjects([]database.Subject{
+		{Congress: 116, Subject: "Energy", BillIDs: []string{"hr1", "hr2"}},
+		{Congress: 116, Subject: "Health", BillIDs: []string{"hr3"}},
+		{Congress: 115, Subject: "Energy", BillIDs: []string{"hr4"}},
+		{Congress: 115, Subject: "Health", BillIDs: []string{"hr1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := Filter{Query: bson.M{"subjects": bson.M{"$in": []string{"Energy"}}}, Subjects: []string{"Energy"}}
+
+	var ndjson bytes.Buffer
+	n, err := Export(store, "cells", NDJSON, filter, &ndjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	if n != 2 || !strings.Contains(lines[0], `"count":1,`) || !strings.Contains(lines[0], `"billIds":["hr4"]`) ||
+		!strings.Contains(lines[1], `"count":2,"fractional":1.5,`) || !strings.Contains(lines[1], `"billIds":["hr1","hr2"]`) {
+		t.Fatalf("ndjson export = %q", ndjson.String())
+	}
+
+	// the export agrees with the listing's trimming
+	cells, err = store.GetCells(116, bson.M{}, []string{"Energy"}, database.Window{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 1 || cells[0].Count != 2 || cells[0].Weights.Fractional != 1.5 {
+		t.Errorf("listed cells = %+v", cells)
+	}
+}
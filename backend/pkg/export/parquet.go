@@ -0,0 +1,372 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// rowGroupSize is the number of rows buffered before a Parquet row group is written
+const rowGroupSize = 10000
+
+// parquetMagic opens and closes every Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet physical types, converted types, encodings and repetitions
+// See https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8 = 0
+	convertedDate = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	repetitionOptional = 1
+)
+
+// parquetWriter writes rows as an uncompressed Parquet file of optional, plainly encoded columns
+// Rows are buffered into row groups of rowGroupSize, each written as one data page per column,
+// and the footer describing the row groups is written on close
+type parquetWriter struct {
+	w         *countingWriter
+	columns   []column
+	rows      [][]interface{}
+	rowGroups []parquetRowGroup
+	numRows   int64
+}
+
+type parquetRowGroup struct {
+	chunks    []parquetChunk
+	numRows   int64
+	totalSize int64
+}
+
+// parquetChunk locates a column's data page within the file
+type parquetChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newParquetWriter(w io.Writer, columns []column) *parquetWriter {
+	return &parquetWriter{w: &countingWriter{w: w}, columns: columns}
+}
+
+func (p *parquetWriter) write(row []interface{}) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= rowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.w.n == 0 {
+		if _, err := io.WriteString(p.w, parquetMagic); err != nil {
+			return err
+		}
+	}
+	footer := p.footer()
+	if _, err := p.w.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(p.w, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(p.w, parquetMagic)
+	return err
+}
+
+// flush writes the buffered rows as a row group
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	if p.w.n == 0 {
+		if _, err := io.WriteString(p.w, parquetMagic); err != nil {
+			return err
+		}
+	}
+	group := parquetRowGroup{numRows: int64(len(p.rows))}
+	for i, col := range p.columns {
+		page := p.page(i, col)
+		chunk := parquetChunk{offset: p.w.n, numValues: int64(len(p.rows))}
+		if _, err := p.w.Write(page); err != nil {
+			return err
+		}
+		chunk.size = p.w.n - chunk.offset
+		group.totalSize += chunk.size
+		group.chunks = append(group.chunks, chunk)
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.numRows += group.numRows
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// page encodes the buffered values of a column as a data page, header included
+func (p *parquetWriter) page(i int, col column) []byte {
+	defined := make([]bool, len(p.rows))
+	var values bytes.Buffer
+	var bits []bool
+	for r, row := range p.rows {
+		v := row[i]
+		if v == nil {
+			continue
+		}
+		defined[r] = true
+		switch col.kind {
+		case kindInt:
+			binary.Write(&values, binary.LittleEndian, int64(v.(int)))
+		case kindFloat:
+			binary.Write(&values, binary.LittleEndian, math.Float64bits(v.(float64)))
+		case kindBool:
+			bits = append(bits, v.(bool))
+		case kindDate:
+			binary.Write(&values, binary.LittleEndian, epochDays(v.(time.Time)))
+		default:
+			s := formatValue(v)
+			binary.Write(&values, binary.LittleEndian, uint32(len(s)))
+			values.WriteString(s)
+		}
+	}
+	if col.kind == kindBool {
+		values.Write(packBits(bits))
+	}
+
+	levels := rleLevels(defined)
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(len(levels)))
+	body.Write(levels)
+	body.Write(values.Bytes())
+
+	var header compact
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(body.Len()))
+	header.i32(3, int32(body.Len()))
+	header.begin(5)
+	header.i32(1, int32(len(p.rows)))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.end()
+	header.stop()
+	return append(header.Bytes(), body.Bytes()...)
+}
+
+// footer encodes the file metadata
+func (p *parquetWriter) footer() []byte {
+	var meta compact
+	meta.i32(1, 1)
+	meta.list(2, ctStruct, len(p.columns)+1)
+	meta.elem()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.end()
+	for _, col := range p.columns {
+		physical, converted := parquetType(col.kind)
+		meta.elem()
+		meta.i32(1, physical)
+		meta.i32(3, repetitionOptional)
+		meta.str(4, col.name)
+		if converted >= 0 {
+			meta.i32(6, converted)
+		}
+		meta.end()
+	}
+	meta.i64(3, p.numRows)
+	meta.list(4, ctStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		meta.elem()
+		meta.list(1, ctStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := parquetType(p.columns[i].kind)
+			meta.elem()
+			meta.i64(2, chunk.offset)
+			meta.begin(3)
+			meta.i32(1, physical)
+			meta.list(2, ctI32, 2)
+			meta.varint(zigzag(encodingPlain))
+			meta.varint(zigzag(encodingRLE))
+			meta.list(3, ctBinary, 1)
+			meta.varint(uint64(len(p.columns[i].name)))
+			meta.WriteString(p.columns[i].name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, group.totalSize)
+		meta.i64(3, group.numRows)
+		meta.end()
+	}
+	meta.str(6, "cosign export")
+	meta.stop()
+	return meta.Bytes()
+}
+
+// parquetType maps a column kind to its physical and converted types, -1 marking no converted type
+func parquetType(kind int) (int32, int32) {
+	switch kind {
+	case kindInt:
+		return typeInt64, -1
+	case kindFloat:
+		return typeDouble, -1
+	case kindBool:
+		return typeBoolean, -1
+	case kindDate:
+		return typeInt32, convertedDate
+	}
+	return typeByteArray, convertedUTF8
+}
+
+// epochDays returns the number of days from 1970-01-01 to the date of t
+func epochDays(t time.Time) int32 {
+	y, m, d := t.Date()
+	return int32(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// packBits packs booleans least significant bit first
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// rleLevels encodes definition levels as runs of the RLE/bit-packing hybrid with a bit width of 1
+func rleLevels(defined []bool) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		writeUvarint(&buf, uint64(j-i)<<1)
+		if defined[i] {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		i = j
+	}
+	return buf.Bytes()
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// Thrift compact protocol types
+const (
+	ctI32    = 5
+	ctI64    = 6
+	ctBinary = 8
+	ctList   = 9
+	ctStruct = 12
+)
+
+// compact encodes Thrift structs with the compact protocol, tracking the last field ID of each open struct
+type compact struct {
+	bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (c *compact) varint(v uint64) {
+	writeUvarint(&c.Buffer, v)
+}
+
+func (c *compact) field(id int16, t byte) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.WriteByte(byte(delta)<<4 | t)
+	} else {
+		c.WriteByte(t)
+		c.varint(zigzag(int64(id)))
+	}
+	c.last = id
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, ctI32)
+	c.varint(zigzag(int64(v)))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, ctI64)
+	c.varint(zigzag(v))
+}
+
+func (c *compact) str(id int16, s string) {
+	c.field(id, ctBinary)
+	c.varint(uint64(len(s)))
+	c.WriteString(s)
+}
+
+// list opens a list field of n elements, which the caller then writes
+func (c *compact) list(id int16, t byte, n int) {
+	c.field(id, ctList)
+	if n < 15 {
+		c.WriteByte(byte(n)<<4 | t)
+	} else {
+		c.WriteByte(0xf0 | t)
+		c.varint(uint64(n))
+	}
+}
+
+// begin opens a struct field
+func (c *compact) begin(id int16) {
+	c.field(id, ctStruct)
+	c.elem()
+}
+
+// elem opens a struct element of a list
+func (c *compact) elem() {
+	c.stack = append(c.stack, c.last)
+	c.last = 0
+}
+
+// end closes the innermost open struct
+func (c *compact) end() {
+	c.stop()
+	c.last = c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// stop terminates the outermost struct
+func (c *compact) stop() {
+	c.WriteByte(0)
+}
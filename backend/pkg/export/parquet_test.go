@@ -0,0 +1,275 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the compact protocol into maps of field ID to value
+type thriftReader struct {
+	b []byte
+	p int
+}
+
+func (r *thriftReader) byte() byte {
+	v := r.b[r.p]
+	r.p++
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.p:])
+	r.p += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(t byte) interface{} {
+	switch t {
+	case 1, 2:
+		return t == 1
+	case ctI32, ctI64:
+		return r.zigzag()
+	case ctBinary:
+		n := int(r.uvarint())
+		r.p += n
+		return string(r.b[r.p-n : r.p])
+	case ctList:
+		h := r.byte()
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case ctStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", t))
+}
+
+func (r *thriftReader) structure() map[int64]interface{} {
+	fields := map[int64]interface{}{}
+	var last int64
+	for {
+		h := r.byte()
+		if h == 0 {
+			return fields
+		}
+		id := last + int64(h>>4)
+		if h>>4 == 0 {
+			id = r.zigzag()
+		}
+		last = id
+		fields[id] = r.value(h & 0x0f)
+	}
+}
+
+// readColumn decodes a column chunk's data page into its values, nil marking nulls
+func readColumn(t *testing.T, file []byte, meta map[int64]interface{}) []interface{} {
+	r := &thriftReader{b: file, p: int(meta[9].(int64))}
+	header := r.structure()
+	body := file[r.p : r.p+int(header[3].(int64))]
+	numValues := int(header[5].(map[int64]interface{})[1].(int64))
+
+	n := int(binary.LittleEndian.Uint32(body))
+	levels := &thriftReader{b: body[4 : 4+n]}
+	defined := []bool{}
+	for levels.p < n {
+		run := levels.uvarint()
+		if run&1 != 0 {
+			t.Fatalf("unexpected bit-packed run")
+		}
+		level := levels.byte()
+		for i := 0; i < int(run>>1); i++ {
+			defined = append(defined, level == 1)
+		}
+	}
+	if len(defined) != numValues {
+		t.Fatalf("%d definition levels for %d values", len(defined), numValues)
+	}
+
+	values := body[4+n:]
+	out := make([]interface{}, numValues)
+	bit := 0
+	for i, d := range defined {
+		if !d {
+			continue
+		}
+		switch meta[1].(int64) {
+		case typeBoolean:
+			out[i] = values[bit/8]>>uint(bit%8)&1 == 1
+			bit++
+		case typeInt32:
+			out[i] = int32(binary.LittleEndian.Uint32(values))
+			values = values[4:]
+		case typeInt64:
+			out[i] = int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case typeDouble:
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case typeByteArray:
+			m := binary.LittleEndian.Uint32(values)
+			out[i] = string(values[4 : 4+m])
+			values = values[4+m:]
+		}
+	}
+	return out
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	// 16 columns make a 17 element schema list, which needs the long list header
+	columns := []column{
+		{"int", kindInt}, {"bool", kindBool}, {"string", kindString}, {"date", kindDate},
+		{"float", kindFloat}, {"list", kindList},
+	}
+	for i := len(columns); i < 16; i++ {
+		columns = append(columns, column{fmt.Sprintf("pad%d", i), kindInt})
+	}
+	date := time.Date(2019, 1, 3, 12, 0, 0, 0, time.UTC)
+	rows := [][]interface{}{
+		{1, true, "a", date, 0.5, []string{"x", "y"}},
+		{nil, false, nil, nil, nil, []string{}},
+		{nil, nil, "", date, -1.25, nil},
+		{4, true, "héllo", nil, nil, []string{"z"}},
+	}
+	// nine more rows spill the booleans into a second byte
+	for i := 0; i < 9; i++ {
+		rows = append(rows, []interface{}{i, i%3 == 0, nil, nil, nil, nil})
+	}
+
+	var buf bytes.Buffer
+	p := newParquetWriter(&buf, columns)
+	for _, row := range rows {
+		full := make([]interface{}, len(columns))
+		copy(full, row)
+		if err := p.write(full); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+		t.Fatalf("missing magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	r := &thriftReader{b: file, p: len(file) - 8 - footerLen}
+	meta := r.structure()
+	if r.p != len(file)-8 {
+		t.Fatalf("footer decoded to %d, want %d", r.p, len(file)-8)
+	}
+	if meta[3].(int64) != int64(len(rows)) {
+		t.Errorf("num_rows = %v, want %d", meta[3], len(rows))
+	}
+
+	schema := meta[2].([]interface{})
+	if len(schema) != len(columns)+1 {
+		t.Fatalf("%d schema elements, want %d", len(schema), len(columns)+1)
+	}
+	if root := schema[0].(map[int64]interface{}); root[5].(int64) != int64(len(columns)) {
+		t.Errorf("root has %v children", root[5])
+	}
+	for i, col := range columns {
+		el := schema[i+1].(map[int64]interface{})
+		physical, converted := parquetType(col.kind)
+		if el[4] != col.name || el[1].(int64) != int64(physical) || el[3].(int64) != repetitionOptional {
+			t.Errorf("schema element %d = %v", i, el)
+		}
+		if c, ok := el[6]; ok != (converted >= 0) || ok && c.(int64) != int64(converted) {
+			t.Errorf("%s converted type = %v, want %d", col.name, c, converted)
+		}
+	}
+
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, want 1", len(groups))
+	}
+	chunks := groups[0].(map[int64]interface{})[1].([]interface{})
+	want := map[string][]interface{}{
+		"int":    {int64(1), nil, nil, int64(4)},
+		"bool":   {true, false, nil, true},
+		"string": {"a", nil, "", "héllo"},
+		"date":   {int32(17899), nil, int32(17899), nil},
+		"float":  {0.5, nil, -1.25, nil},
+		"list":   {"x;y", "", nil, "z"},
+	}
+	for i, chunk := range chunks {
+		meta := chunk.(map[int64]interface{})[3].(map[int64]interface{})
+		if meta[3].([]interface{})[0] != columns[i].name {
+			t.Errorf("chunk %d path = %v", i, meta[3])
+		}
+		got := readColumn(t, file, meta)
+		if len(got) != len(rows) {
+			t.Fatalf("%s has %d values", columns[i].name, len(got))
+		}
+		if w, ok := want[columns[i].name]; ok {
+			for j := range w {
+				if got[j] != w[j] {
+					t.Errorf("%s[%d] = %v, want %v", columns[i].name, j, got[j], w[j])
+				}
+			}
+		}
+		if columns[i].name == "bool" {
+			for j := 0; j < 9; j++ {
+				if got[4+j] != (j%3 == 0) {
+					t.Errorf("bool[%d] = %v", 4+j, got[4+j])
+				}
+			}
+		}
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	p := newParquetWriter(&buf, []column{{"n", kindInt}})
+	for i := 0; i < rowGroupSize+1; i++ {
+		if err := p.write([]interface{}{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := (&thriftReader{b: file, p: len(file) - 8 - footerLen}).structure()
+	groups := meta[4].([]interface{})
+	if len(groups) != 2 || groups[1].(map[int64]interface{})[3].(int64) != 1 {
+		t.Fatalf("row groups = %v", groups)
+	}
+	chunk := groups[1].(map[int64]interface{})[1].([]interface{})[0].(map[int64]interface{})
+	if got := readColumn(t, file, chunk[3].(map[int64]interface{})); got[0] != int64(rowGroupSize) {
+		t.Errorf("second row group holds %v", got)
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newParquetWriter(&buf, []column{{"n", kindInt}}).close(); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if string(file[:4]) != parquetMagic || 4+footerLen+8 != len(file) {
+		t.Fatalf("malformed empty file %q", file)
+	}
+	meta := (&thriftReader{b: file, p: 4}).structure()
+	if meta[3].(int64) != 0 || len(meta[4].([]interface{})) != 0 {
+		t.Errorf("empty file metadata = %v", meta)
+	}
+}
@@ -0,0 +1,162 @@
+package graph
+
+import "math"
+
+const (
+	maxIterations = 1000
+	tolerance     = 1e-10
+)
+
+// Degree returns the number of neighbors of each node
+func (g *Graph) Degree() []int {
+	degree := make([]int, len(g.Nodes))
+	for i, neighbors := range g.adj {
+		degree[i] = len(neighbors)
+	}
+	return degree
+}
+
+// WeightedDegree returns the total weight of the edges of each node
+func (g *Graph) WeightedDegree() []float64 {
+	strength := make([]float64, len(g.Nodes))
+	for i, neighbors := range g.adj {
+		for _, w := range neighbors {
+			strength[i] += w
+		}
+	}
+	return strength
+}
+
+// Betweenness returns the number of shortest paths between other pairs of nodes passing through each node,
+// computed with Brandes' algorithm over hop counts (weights are ignored)
+func (g *Graph) Betweenness() []float64 {
+	n := len(g.Nodes)
+	betweenness := make([]float64, n)
+	sigma := make([]float64, n)
+	dist := make([]int, n)
+	delta := make([]float64, n)
+	preds := make([][]int, n)
+	for s := 0; s < n; s++ {
+		for i := 0; i < n; i++ {
+			sigma[i] = 0
+			dist[i] = -1
+			delta[i] = 0
+			preds[i] = preds[i][:0]
+		}
+		sigma[s] = 1
+		dist[s] = 0
+		order := []int{}
+		queue := []int{s}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			order = append(order, v)
+			for w := range g.adj[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+		for i := len(order) - 1; i >= 0; i-- {
+			w := order[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				betweenness[w] += delta[w]
+			}
+		}
+	}
+	// each undirected path was counted from both of its ends
+	for i := range betweenness {
+		betweenness[i] /= 2
+	}
+	return betweenness
+}
+
+// Eigenvector returns the eigenvector centrality of each node over the weighted adjacency matrix,
+// scaled so the most central node scores 1
+// Power iteration runs on A+I, which shares A's eigenvectors but converges on bipartite graphs too
+func (g *Graph) Eigenvector() []float64 {
+	n := len(g.Nodes)
+	x := make([]float64, n)
+	edges := 0
+	for i := range x {
+		x[i] = 1
+		edges += len(g.adj[i])
+	}
+	// without edges the identity would leave every node at 1
+	if edges == 0 {
+		return make([]float64, n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < maxIterations; iter++ {
+		max := 0.0
+		for i := range next {
+			next[i] = x[i]
+			for j, w := range g.adj[i] {
+				next[i] += w * x[j]
+			}
+			max = math.Max(max, next[i])
+		}
+		change := 0.0
+		for i := range next {
+			next[i] /= max
+			change += math.Abs(next[i] - x[i])
+		}
+		x, next = next, x
+		if change < tolerance*float64(n) {
+			break
+		}
+	}
+	return x
+}
+
+// PageRank returns the PageRank of each node, following edges in proportion to their weight
+// The rank of nodes without edges is spread evenly across the graph
+func (g *Graph) PageRank(damping float64) []float64 {
+	n := len(g.Nodes)
+	if n == 0 {
+		return nil
+	}
+	strength := g.WeightedDegree()
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+	for iter := 0; iter < maxIterations; iter++ {
+		dangling := 0.0
+		for i := range rank {
+			if strength[i] == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, neighbors := range g.adj {
+			if strength[i] == 0 {
+				continue
+			}
+			for j, w := range neighbors {
+				next[j] += damping * rank[i] * w / strength[i]
+			}
+		}
+		change := 0.0
+		for i := range next {
+			change += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if change < tolerance {
+			break
+		}
+	}
+	return rank
+}
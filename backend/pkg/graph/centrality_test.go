@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// karate builds Zachary's karate club network, nodes named n0 (the instructor) to n33 (the administrator)
+func karate() *Graph {
+	edges := map[int][]int{
+		0: {1, 2, 3, 4, 5, 6, 7, 8, 10, 11, 12, 13, 17, 19, 21, 31}, 1: {2, 3, 7, 13, 17, 19, 21, 30},
+		2: {3, 7, 8, 9, 13, 27, 28, 32}, 3: {7, 12, 13}, 4: {6, 10}, 5: {6, 10, 16}, 6: {16}, 8: {30, 32, 33},
+		9: {33}, 13: {33}, 14: {32, 33}, 15: {32, 33}, 18: {32, 33}, 19: {33}, 20: {32, 33}, 22: {32, 33},
+		23: {25, 27, 29, 32, 33}, 24: {25, 27, 31}, 25: {31}, 26: {29, 33}, 27: {33}, 28: {31, 33},
+		29: {32, 33}, 30: {32, 33}, 31: {32, 33}, 32: {33},
+	}
+	nodes := make([]string, 34)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("n%d", i)
+	}
+	g := New(nodes)
+	for a, bs := range edges {
+		for _, b := range bs {
+			g.AddEdge(nodes[a], nodes[b], 1)
+		}
+	}
+	return g
+}
+
+// build returns a graph over the named nodes with unit weight edges
+func build(t *testing.T, nodes []string, edges ...[2]string) *Graph {
+	t.Helper()
+	g := New(nodes)
+	for _, e := range edges {
+		if err := g.AddEdge(e[0], e[1], 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func star() *Graph {
+	g := New([]string{"hub", "a", "b", "c", "d"})
+	for _, leaf := range g.Nodes[1:] {
+		g.AddEdge("hub", leaf, 1)
+	}
+	return g
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func expect(t *testing.T, measure string, got []float64, want map[int]float64) {
+	t.Helper()
+	for i, w := range want {
+		if !near(got[i], w) {
+			t.Errorf("%s[%d] = %v, want %v", measure, i, got[i], w)
+		}
+	}
+}
+
+func TestAddEdge(t *testing.T) {
+	g := New([]string{"a", "b"})
+	if err := g.AddEdge("a", "c", 1); err == nil {
+		t.Errorf("edge to an unknown node was added")
+	}
+	if err := g.AddEdge("a", "a", 1); err == nil {
+		t.Errorf("self loop was added")
+	}
+	g.AddEdge("a", "b", 1)
+	g.AddEdge("b", "a", 2.5)
+	if d := g.Degree(); d[0] != 1 || d[1] != 1 {
+		t.Errorf("degree = %v", d)
+	}
+	expect(t, "weighted degree", g.WeightedDegree(), map[int]float64{0: 3.5, 1: 3.5})
+}
+
+func TestStar(t *testing.T) {
+	g := star()
+	if d := g.Degree(); d[0] != 4 || d[1] != 1 {
+		t.Errorf("degree = %v", d)
+	}
+	// every pair of leaves has one shortest path, through the hub
+	expect(t, "betweenness", g.Betweenness(), map[int]float64{0: 6, 1: 0, 4: 0})
+	// the star is bipartite, with principal eigenvalue 2 and leaves scoring 1/2 of the hub
+	expect(t, "eigenvector", g.Eigenvector(), map[int]float64{0: 1, 1: 0.5, 4: 0.5})
+	// hub = 0.15/5 + 0.85*4*leaf and leaf = 0.15/5 + 0.85*hub/4
+	expect(t, "pagerank", g.PageRank(0.85), map[int]float64{0: 0.132 / 0.2775, 1: (1 - 0.132/0.2775) / 4})
+}
+
+func TestBetweennessSplitsPaths(t *testing.T) {
+	// a square has two shortest paths between opposite corners, one through each other corner
+	g := build(t, []string{"a", "b", "c", "d"}, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"}, [2]string{"d", "a"})
+	expect(t, "betweenness", g.Betweenness(), map[int]float64{0: 0.5, 1: 0.5, 2: 0.5, 3: 0.5})
+
+	// weights are ignored, so a heavy detour does not change a path's hops
+	g = build(t, []string{"a", "b", "c", "d"}, [2]string{"a", "b"}, [2]string{"b", "c"}, [2]string{"c", "d"})
+	g.AddEdge("a", "c", 10)
+	expect(t, "betweenness", g.Betweenness(), map[int]float64{0: 0, 1: 0, 2: 2, 3: 0})
+}
+
+func TestEigenvectorPath(t *testing.T) {
+	// the path a-b-c has eigenvalue √2 and eigenvector (1, √2, 1)
+	g := build(t, []string{"a", "b", "c"}, [2]string{"a", "b"}, [2]string{"b", "c"})
+	expect(t, "eigenvector", g.Eigenvector(), map[int]float64{0: math.Sqrt2 / 2, 1: 1, 2: math.Sqrt2 / 2})
+
+	// weights scale the adjacency matrix, here to eigenvector (1, √5, 2)
+	g = New([]string{"a", "b", "c"})
+	g.AddEdge("a", "b", 1)
+	g.AddEdge("b", "c", 2)
+	expect(t, "eigenvector", g.Eigenvector(), map[int]float64{0: 1 / math.Sqrt(5), 1: 1, 2: 2 / math.Sqrt(5)})
+
+	// isolated nodes score 0, with or without edges elsewhere
+	g = build(t, []string{"a", "b", "c"}, [2]string{"a", "b"})
+	expect(t, "eigenvector", g.Eigenvector(), map[int]float64{0: 1, 1: 1, 2: 0})
+	if e := New([]string{"a", "b"}).Eigenvector(); e[0] != 0 || e[1] != 0 {
+		t.Errorf("edgeless eigenvector = %v", e)
+	}
+}
+
+func TestPageRankDangling(t *testing.T) {
+	// the isolated c spreads its rank evenly: c = 0.15/3 + 0.85*c/3
+	g := build(t, []string{"a", "b", "c"}, [2]string{"a", "b"})
+	c := 0.05 / (1 - 0.85/3)
+	rank := g.PageRank(0.85)
+	expect(t, "pagerank", rank, map[int]float64{0: (1 - c) / 2, 1: (1 - c) / 2, 2: c})
+	if sum := rank[0] + rank[1] + rank[2]; !near(sum, 1) {
+		t.Errorf("ranks sum to %v", sum)
+	}
+	if New(nil).PageRank(0.85) != nil {
+		t.Errorf("empty graph has ranks")
+	}
+}
+
+func TestKarate(t *testing.T) {
+	g := karate()
+	if d := g.Degree(); d[0] != 16 || d[33] != 17 || d[11] != 1 {
+		t.Errorf("degree = %v", d)
+	}
+	// reference values agree with networkx's betweenness_centrality (unnormalized) and pagerank
+	expect(t, "betweenness", g.Betweenness(), map[int]float64{0: 231.0714285714, 33: 160.5515873016, 32: 76.6904761905, 11: 0})
+	expect(t, "pagerank", g.PageRank(0.85), map[int]float64{0: 0.0969972854, 33: 0.1009191823, 11: 0.0095647455})
+	expect(t, "eigenvector", g.Eigenvector(), map[int]float64{33: 1, 0: 0.9521323665, 2: 0.8495542005})
+
+	metrics := g.Metrics()
+	if m := metrics["n0"]; m.Degree != 16 || m.WeightedDegree != 16 || !near(m.Betweenness, 231.0714285714) {
+		t.Errorf("metrics of n0 = %+v", m)
+	}
+}
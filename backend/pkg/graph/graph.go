@@ -0,0 +1,107 @@
+// Package graph analyzes the cosponsorship network of a congress
+package graph
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Graph is an undirected weighted graph whose nodes are members' bioguide IDs
+type Graph struct {
+	Nodes []string
+	index map[string]int
+	adj   []map[int]float64
+}
+
+// New returns a graph over the supplied nodes without any edges
+func New(nodes []string) *Graph {
+	g := &Graph{
+		Nodes: nodes,
+		index: map[string]int{},
+		adj:   make([]map[int]float64, len(nodes)),
+	}
+	for i, node := range nodes {
+		g.index[node] = i
+		g.adj[i] = map[int]float64{}
+	}
+	return g
+}
+
+// AddEdge adds w to the weight of the edge between a and b
+func (g *Graph) AddEdge(a, b string, w float64) error {
+	i, ok := g.index[a]
+	if !ok {
+		return fmt.Errorf("unknown node %q", a)
+	}
+	j, ok := g.index[b]
+	if !ok {
+		return fmt.Errorf("unknown node %q", b)
+	}
+	if i == j {
+		return fmt.Errorf("self loop on %q", a)
+	}
+	g.adj[i][j] += w
+	g.adj[j][i] += w
+	return nil
+}
+
+// Load builds the network of a chamber of a congress from its members and cells
+// Edges are the cells of the supplied edge policy (cross, same or all), weighted by the supplied scheme
+func Load(store database.Store, congress int, chamber, edges, weight string) (*Graph, error) {
+	kinds, err := database.EdgeKinds(edges)
+	if err != nil {
+		return nil, err
+	}
+	if !database.ValidWeight(weight) {
+		return nil, fmt.Errorf("unknown weighting scheme %q", weight)
+	}
+	members, _, err := store.GetMembers(bson.M{"congress": congress, "chamber": chamber})
+	if err != nil {
+		return nil, err
+	}
+	nodes := []string{}
+	for _, m := range members {
+		nodes = append(nodes, m.BioguideID)
+	}
+	sort.Strings(nodes)
+	g := New(nodes)
+	cells, err := store.GetCells(congress, bson.M{"chamber": chamber, "edges": bson.M{"$in": kinds}}, nil, database.Window{})
+	if err != nil {
+		return nil, err
+	}
+	for _, cell := range cells {
+		cell.SetWeight(weight)
+		pair := strings.Split(cell.Position, "_")
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("bad cell position %q", cell.Position)
+		}
+		if err := g.AddEdge(pair[0], pair[1], cell.Weight); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Metrics computes every centrality measure for each node, keyed by bioguide ID
+func (g *Graph) Metrics() map[string]database.Metrics {
+	degree := g.Degree()
+	weighted := g.WeightedDegree()
+	betweenness := g.Betweenness()
+	eigenvector := g.Eigenvector()
+	pageRank := g.PageRank(0.85)
+	metrics := map[string]database.Metrics{}
+	for i, node := range g.Nodes {
+		metrics[node] = database.Metrics{
+			Degree:         degree[i],
+			WeightedDegree: weighted[i],
+			Betweenness:    betweenness[i],
+			Eigenvector:    eigenvector[i],
+			PageRank:       pageRank[i],
+		}
+	}
+	return metrics
+}
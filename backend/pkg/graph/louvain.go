@@ -0,0 +1,201 @@
+package graph
+
+import "sort"
+
+// minGain is the smallest modularity improvement worth a move, guarding against float noise
+const minGain = 1e-12
+
+// level is a graph being partitioned by the Louvain method
+// adj is symmetric and holds twice the internal weight of an aggregated node on its diagonal,
+// so each node's degree is the sum of its row
+type level struct {
+	adj    []map[int]float64
+	degree []float64
+	total  float64
+}
+
+func newLevel(adj []map[int]float64) *level {
+	l := &level{adj: adj, degree: make([]float64, len(adj))}
+	for i, neighbors := range adj {
+		for _, w := range neighbors {
+			l.degree[i] += w
+		}
+		l.total += l.degree[i]
+	}
+	return l
+}
+
+// moveNodes repeatedly moves each node to the neighboring community with the largest modularity gain
+// until no move helps, returning the community of each node and whether any node moved
+func (l *level) moveNodes() ([]int, bool) {
+	n := len(l.adj)
+	community := make([]int, n)
+	tot := make([]float64, n)
+	for i := range community {
+		community[i] = i
+		tot[i] = l.degree[i]
+	}
+	moved := false
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < n; i++ {
+			if l.degree[i] == 0 {
+				continue
+			}
+			// weight from i into each neighboring community
+			links := map[int]float64{}
+			for j, w := range l.adj[i] {
+				if j != i {
+					links[community[j]] += w
+				}
+			}
+			current := community[i]
+			tot[current] -= l.degree[i]
+			best := current
+			bestGain := links[current] - tot[current]*l.degree[i]/l.total
+			candidates := []int{}
+			for c := range links {
+				candidates = append(candidates, c)
+			}
+			sort.Ints(candidates)
+			for _, c := range candidates {
+				gain := links[c] - tot[c]*l.degree[i]/l.total
+				if gain > bestGain+minGain {
+					best, bestGain = c, gain
+				}
+			}
+			tot[best] += l.degree[i]
+			if best != current {
+				community[i] = best
+				improved = true
+				moved = true
+			}
+		}
+	}
+	return renumber(community), moved
+}
+
+// aggregate collapses each community into a single node
+func (l *level) aggregate(community []int, count int) *level {
+	adj := make([]map[int]float64, count)
+	for c := range adj {
+		adj[c] = map[int]float64{}
+	}
+	for i, neighbors := range l.adj {
+		for j, w := range neighbors {
+			adj[community[i]][community[j]] += w
+		}
+	}
+	return newLevel(adj)
+}
+
+// renumber relabels communities as 0..k-1 in order of first appearance
+func renumber(community []int) []int {
+	labels := map[int]int{}
+	out := make([]int, len(community))
+	for i, c := range community {
+		if _, ok := labels[c]; !ok {
+			labels[c] = len(labels)
+		}
+		out[i] = labels[c]
+	}
+	return out
+}
+
+// Louvain partitions the graph into communities of high modularity with the Louvain method
+// Communities are numbered from 1 in order of decreasing size; nodes without edges are left in community 0
+func (g *Graph) Louvain() []int {
+	n := len(g.Nodes)
+	adj := make([]map[int]float64, n)
+	for i, neighbors := range g.adj {
+		adj[i] = map[int]float64{}
+		for j, w := range neighbors {
+			adj[i][j] = w
+		}
+	}
+	l := newLevel(adj)
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+	if l.total == 0 {
+		return make([]int, n)
+	}
+	for {
+		community, moved := l.moveNodes()
+		if !moved {
+			break
+		}
+		count := 0
+		for i := range membership {
+			membership[i] = community[membership[i]]
+		}
+		for _, c := range community {
+			if c+1 > count {
+				count = c + 1
+			}
+		}
+		l = l.aggregate(community, count)
+	}
+	return g.label(membership)
+}
+
+// label numbers communities by decreasing size, breaking ties by their first node, leaving isolated nodes in 0
+func (g *Graph) label(membership []int) []int {
+	size := map[int]int{}
+	first := map[int]int{}
+	for i, c := range membership {
+		if len(g.adj[i]) == 0 {
+			continue
+		}
+		if _, ok := first[c]; !ok {
+			first[c] = i
+		}
+		size[c]++
+	}
+	order := []int{}
+	for c := range size {
+		order = append(order, c)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if size[order[i]] != size[order[j]] {
+			return size[order[i]] > size[order[j]]
+		}
+		return first[order[i]] < first[order[j]]
+	})
+	labels := map[int]int{}
+	for i, c := range order {
+		labels[c] = i + 1
+	}
+	out := make([]int, len(membership))
+	for i, c := range membership {
+		if len(g.adj[i]) > 0 {
+			out[i] = labels[c]
+		}
+	}
+	return out
+}
+
+// Modularity returns the modularity of a partition of the graph, as returned by Louvain
+func (g *Graph) Modularity(community []int) float64 {
+	total := 0.0
+	in := map[int]float64{}
+	tot := map[int]float64{}
+	for i, neighbors := range g.adj {
+		for j, w := range neighbors {
+			total += w
+			tot[community[i]] += w
+			if community[i] == community[j] {
+				in[community[i]] += w
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	q := 0.0
+	for c, t := range tot {
+		q += in[c]/total - (t/total)*(t/total)
+	}
+	return q
+}
@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+)
+
+// cliques builds two 4-cliques joined by the edge p3-q0, plus the isolated node z
+func cliques() *Graph {
+	nodes := []string{"q0", "q1", "q2", "q3", "p0", "p1", "p2", "p3", "z"}
+	g := New(nodes)
+	for _, prefix := range []string{"p", "q"} {
+		for i := 0; i < 4; i++ {
+			for j := i + 1; j < 4; j++ {
+				g.AddEdge(fmt.Sprintf("%s%d", prefix, i), fmt.Sprintf("%s%d", prefix, j), 1)
+			}
+		}
+	}
+	g.AddEdge("p3", "q0", 1)
+	return g
+}
+
+func TestLouvainCliques(t *testing.T) {
+	g := cliques()
+	community := g.Louvain()
+	// equal sizes are numbered by first node, and the isolated node stays in 0
+	want := []int{1, 1, 1, 1, 2, 2, 2, 2, 0}
+	for i := range want {
+		if community[i] != want[i] {
+			t.Fatalf("communities = %v, want %v", community, want)
+		}
+	}
+	// 13 edges: each community holds 6 internally and has total degree 13
+	if q := g.Modularity(community); !near(q, 2*(12.0/26-0.25)) {
+		t.Errorf("modularity = %v", q)
+	}
+	if q := g.Modularity(make([]int, len(g.Nodes))); !near(q, 0) {
+		t.Errorf("modularity of a single community = %v", q)
+	}
+}
+
+func TestLouvainWeights(t *testing.T) {
+	// a heavy edge pulls b away from the triangle it would otherwise join
+	g := New([]string{"a", "b", "c", "d", "e"})
+	g.AddEdge("a", "c", 1)
+	g.AddEdge("b", "c", 1)
+	g.AddEdge("a", "b", 1)
+	g.AddEdge("b", "d", 10)
+	g.AddEdge("d", "e", 1)
+	community := g.Louvain()
+	if community[1] != community[3] || community[0] == community[1] || community[0] != community[2] {
+		t.Errorf("communities = %v", community)
+	}
+}
+
+func TestLouvainKarate(t *testing.T) {
+	g := karate()
+	community := g.Louvain()
+	sizes := map[int]int{}
+	for _, c := range community {
+		if c == 0 {
+			t.Fatalf("connected node left in community 0: %v", community)
+		}
+		sizes[c]++
+	}
+	for c := 1; c < len(sizes); c++ {
+		if sizes[c] < sizes[c+1] {
+			t.Errorf("community %d is smaller than %d: %v", c, c+1, sizes)
+		}
+	}
+	// the club split between the instructor and the administrator
+	if community[0] == community[33] {
+		t.Errorf("n0 and n33 share community %d", community[0])
+	}
+	// Louvain reaches 0.4188 on this network, close to the best known partition's 0.4198
+	if q := g.Modularity(community); q < 0.415 || q > 0.4198 {
+		t.Errorf("modularity = %v", q)
+	}
+	if len(sizes) < 3 || len(sizes) > 4 {
+		t.Errorf("%d communities", len(sizes))
+	}
+}
+
+func TestLouvainEmpty(t *testing.T) {
+	community := New([]string{"a", "b"}).Louvain()
+	if len(community) != 2 || community[0] != 0 || community[1] != 0 {
+		t.Errorf("communities without edges = %v", community)
+	}
+}
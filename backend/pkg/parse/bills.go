@@ -2,14 +2,21 @@ package parse
 
 import (
 	"backend/internal/database"
+	"backend/pkg/utility"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Node represents a generic XML node
@@ -33,96 +40,294 @@ func walk(parent *Node, nodes []Node, f func(Node) bool) {
 	}
 }
 
-func parseNames(n Node) []string {
-	fullNames := []string{}
-	for _, child := range n.Nodes {
-		for _, grandchild := range child.Nodes {
-			if grandchild.XMLName.Local == "fullName" {
-				fullNames = append(fullNames, strings.Replace(string(grandchild.Content), "Rep. ", "", 1))
+// namePrefixes are the titles BILLSTATUS prepends to sponsor names
+var namePrefixes = []string{"Rep. ", "Sen. ", "Del. ", "Resident Commissioner "}
+
+func trimNamePrefix(s string) string {
+	for _, prefix := range namePrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return strings.TrimPrefix(s, prefix)
+		}
+	}
+	return s
+}
+
+// parseSponsors reads the full string and bioguide ID of each sponsor item
+func parseSponsors(n Node) []database.Sponsor {
+	sponsors := []database.Sponsor{}
+	for _, item := range n.Nodes {
+		sponsor := database.Sponsor{}
+		for _, field := range item.Nodes {
+			content := strings.TrimSpace(string(field.Content))
+			switch field.XMLName.Local {
+			case "fullName":
+				sponsor.Name = trimNamePrefix(content)
+			case "bioguideId":
+				sponsor.BioguideID = content
+			}
+		}
+		if sponsor.Name != "" {
+			sponsors = append(sponsors, sponsor)
+		}
+	}
+	return sponsors
+}
+
+const dateLayout = "2006-01-02"
+
+// parseDate reads a BILLSTATUS date, which may carry a time component
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > len(dateLayout) {
+		s = s[:len(dateLayout)]
+	}
+	return time.Parse(dateLayout, s)
+}
+
+func parseCosponsors(n Node) ([]database.Cosponsor, error) {
+	cosponsors := []database.Cosponsor{}
+	for _, item := range n.Nodes {
+		c := database.Cosponsor{}
+		for _, field := range item.Nodes {
+			content := strings.TrimSpace(string(field.Content))
+			switch field.XMLName.Local {
+			case "fullName":
+				c.Name = trimNamePrefix(content)
+			case "bioguideId":
+				c.BioguideID = content
+			case "sponsorshipDate":
+				date, err := parseDate(content)
+				if err != nil {
+					return cosponsors, fmt.Errorf("bad sponsorship date for %s: %v", c.Name, err)
+				}
+				c.Date = date
+			case "isOriginalCosponsor":
+				c.Original = strings.EqualFold(content, "true")
+			case "sponsorshipWithdrawnDate":
+				if content == "" {
+					continue
+				}
+				date, err := parseDate(content)
+				if err != nil {
+					return cosponsors, fmt.Errorf("bad withdrawn date for %s: %v", c.Name, err)
+				}
+				c.WithdrawnDate = &date
 			}
 		}
+		cosponsors = append(cosponsors, c)
 	}
-	return fullNames
+	return cosponsors, nil
 }
 
-func parseSubjects(n Node) []string {
+func parseSubjects(n Node) ([]string, error) {
 	subjects := []string{}
 	for _, item := range n.Nodes {
 		if len(item.Nodes) != 1 {
-			panic("Expected a single name node under legislative subjects item")
+			return subjects, fmt.Errorf("expected a single name node under legislative subjects item, found %d", len(item.Nodes))
 		}
 		subjects = append(subjects, string(item.Nodes[0].Content))
 	}
-	return subjects
+	return subjects, nil
+}
+
+var markupPattern = regexp.MustCompile(`<[^>]*>`)
+
+// summaryText reduces the HTML of a CRS summary, which may be wrapped in CDATA or escaped, to plain text
+func summaryText(content []byte) string {
+	s := strings.TrimSpace(string(content))
+	if strings.HasPrefix(s, "<![CDATA[") {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "<![CDATA["), "]]>")
+	} else {
+		s = html.UnescapeString(s)
+	}
+	s = markupPattern.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// parseSummary returns the text of the latest CRS summary
+// Summaries are items of billSummaries in older files and summary nodes in newer ones
+func parseSummary(n Node) (string, error) {
+	var latest time.Time
+	summary := ""
+	var err error
+	walk(&n, n.Nodes, func(item Node) bool {
+		if item.XMLName.Local != "item" && item.XMLName.Local != "summary" {
+			return true
+		}
+		var date time.Time
+		text := ""
+		for _, field := range item.Nodes {
+			switch field.XMLName.Local {
+			case "actionDate":
+				d, dateErr := parseDate(string(field.Content))
+				if dateErr != nil {
+					err = dateErr
+				}
+				date = d
+			case "text":
+				text = summaryText(field.Content)
+			}
+		}
+		if text != "" && !date.Before(latest) {
+			latest, summary = date, text
+		}
+		return false
+	})
+	return summary, err
+}
+
+// partyOf reads the party letter from a full string such as "Smith, Adam [D-WA-9]"
+func partyOf(s string) (byte, error) {
+	tokens := strings.SplitN(s, "[", 2)
+	if len(tokens) != 2 || len(tokens[1]) == 0 {
+		return 0, fmt.Errorf("no party affiliation in %q", s)
+	}
+	return tokens[1][0], nil
 }
 
-func aggregate(bill *database.Bill) {
+// stringParties sets each appearance's party from the letter in its full string
+// PopulateCells later replaces these with the party in effect on each appearance's date
+func stringParties(bill *database.Bill) error {
+	for i, s := range bill.Sponsors {
+		party, err := partyOf(s.Name)
+		if err != nil {
+			return err
+		}
+		bill.Sponsors[i].Party = string(party)
+	}
+	for i, c := range bill.Cosponsors {
+		party, err := partyOf(c.Name)
+		if err != nil {
+			return err
+		}
+		bill.Cosponsors[i].Party = string(party)
+	}
+	return nil
+}
+
+// aggregate counts the parties of the bill's sponsors and active cosponsors
+func aggregate(bill *database.Bill) error {
+	bill.NumDems, bill.NumReps, bill.NumInds, bill.NumLibs, bill.NumCosponsors = 0, 0, 0, 0, 0
+	appearances := append([]database.Sponsor{}, bill.Sponsors...)
+	for _, c := range bill.Cosponsors {
+		if !c.Withdrawn() {
+			bill.NumCosponsors++
+			appearances = append(appearances, database.Sponsor{Name: c.Name, Party: c.Party})
+		}
+	}
 	var d, r, l, i int
-	for _, s := range append(bill.Sponsors, bill.Cosponsors...) {
-		party := strings.Split(s, "[")[1][0]
-		if party == 'D' {
+	for _, s := range appearances {
+		switch s.Party {
+		case "D":
 			bill.NumDems++
 			d = 1
-		} else if party == 'R' {
+		case "R":
 			bill.NumReps++
 			r = 1
-		} else if party == 'I' {
+		case "I":
 			bill.NumInds++
 			i = 1
-		} else if party == 'L' {
+		case "L":
 			bill.NumLibs++
 			l = 1
-		} else {
-			panic("Need to account for more party affiliations than D, R, L, and I")
+		default:
+			return fmt.Errorf("unknown party affiliation %q for %s", s.Party, s.Name)
 		}
 	}
 	bill.Score = bill.NumDems - bill.NumReps
 	bill.MultiParty = d+r+i+l > 1
+	return nil
+}
+
+// billTypePaths maps BILLSTATUS bill types to their congress.gov URL segment
+var billTypePaths = map[string]string{
+	"hr":      "house-bill",
+	"hres":    "house-resolution",
+	"hjres":   "house-joint-resolution",
+	"hconres": "house-concurrent-resolution",
+	"s":       "senate-bill",
+	"sres":    "senate-resolution",
+	"sjres":   "senate-joint-resolution",
+	"sconres": "senate-concurrent-resolution",
+}
+
+// parseVersion is mixed into each file's content hash so that
+// changing what is parsed out of a file forces every file to be parsed again
+const parseVersion = "6"
+
+// unparsedElements are the known children of <bill> that populateBill does not read
+var unparsedElements = map[string]bool{
+	"number": true, "type": true, "createDate": true, "updateDate": true, "updateDateIncludingText": true,
+	"originChamber": true, "originChamberCode": true, "constitutionalAuthorityStatementText": true,
+	"committees": true, "committeeReports": true, "relatedBills": true, "actions": true, "cboCostEstimates": true,
+	"laws": true, "notes": true, "subjects": true, "titles": true, "amendments": true, "textVersions": true,
+	"latestAction": true, "calendarNumbers": true, "recordedVotes": true, "version": true,
 }
 
-func populateBill(path string, throttle chan struct{}, wg *sync.WaitGroup) {
+// populateBill parses a single BILLSTATUS file, recording any problems in the report
+// Files whose content hash is already stored are skipped, and a bill with any bad element is not upserted
+func populateBill(store database.Store, path string, hashes map[string]bool, stats *billStats, report *Report, throttle chan struct{}, wg *sync.WaitGroup) {
 	defer func() {
 		throttle <- struct{}{}
 		wg.Done()
 	}()
 
+	failed := false
+	fail := func(element string, err error) {
+		failed = true
+		report.Addf("bills", path, element, "%v", err)
+	}
+
 	bs, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err.Error())
+		fail("", err)
+		return
+	}
+	sum := sha256.Sum256(append([]byte(parseVersion), bs...))
+	hash := hex.EncodeToString(sum[:])
+	if hashes[hash] {
+		atomic.AddInt64(&stats.unchanged, 1)
+		return
 	}
 	r := bytes.NewReader(bs)
 	dec := xml.NewDecoder(r)
 	var n Node
 	err = dec.Decode(&n)
 	if err != nil {
-		panic(err.Error())
+		fail("", err)
+		return
 	}
 
-	bill := new(database.Bill)
+	bill := &database.Bill{
+		Hash:    hash,
+		Pending: database.Stages,
+	}
 
 	walk(nil, []Node{n}, func(n Node) bool {
-		switch n.XMLName.Local {
+		var err error
+		element := n.XMLName.Local
+		switch element {
 		case "billNumber":
-			n, err := strconv.Atoi(string(n.Content))
-			if err != nil {
-				panic(err.Error())
+			bill.Number, err = strconv.Atoi(string(n.Content))
+		case "billType":
+			if n.Parent == "bill" {
+				bill.Type = strings.ToLower(string(n.Content))
+			}
+		case "introducedDate":
+			if n.Parent == "bill" {
+				bill.Introduced, err = parseDate(string(n.Content))
+			}
+		case "congress":
+			if n.Parent == "bill" {
+				bill.Congress, err = strconv.Atoi(string(n.Content))
 			}
-			bill.Number = int(n)
 		case "sponsors":
 			if n.Parent == "bill" {
-				sponsors := parseNames(n)
-				if err != nil {
-					panic(err.Error())
-				}
-				bill.Sponsors = sponsors
+				bill.Sponsors = parseSponsors(n)
 			}
 		case "cosponsors":
 			if n.Parent == "bill" {
-				cosponsors := parseNames(n)
-				if err != nil {
-					panic(err.Error())
-				}
-				bill.Cosponsors = cosponsors
+				bill.Cosponsors, err = parseCosponsors(n)
 			}
 		case "title":
 			if n.Parent == "bill" {
@@ -132,42 +337,86 @@ func populateBill(path string, throttle chan struct{}, wg *sync.WaitGroup) {
 		case "policyArea":
 			if len(n.Nodes) > 0 {
 				if n.Nodes[0].XMLName.Local != "name" {
-					panic("bad assumption on policy area")
+					err = fmt.Errorf("expected a name node under policy area, found %s", n.Nodes[0].XMLName.Local)
+				} else {
+					bill.PolicyArea = string(n.Nodes[0].Content)
 				}
-				bill.PolicyArea = string(n.Nodes[0].Content)
 			}
 		case "legislativeSubjects":
-			bill.Subjects = parseSubjects(n)
+			bill.Subjects, err = parseSubjects(n)
+		case "summaries":
+			if n.Parent == "bill" {
+				bill.Summary, err = parseSummary(n)
+			}
+		default:
+			// the bill is still upserted, as an unknown element only means the schema has grown
+			if n.Parent == "bill" && !unparsedElements[element] {
+				report.Addf("bills", path, element, "unexpected element under bill")
+			}
+		}
+		if err != nil {
+			fail(element, err)
 		}
-		// TODO: need a default case?
 		return true
 	})
 
-	aggregate(bill)
+	if err := stringParties(bill); err != nil {
+		fail("sponsors", err)
+	} else if err := aggregate(bill); err != nil {
+		fail("sponsors", err)
+	}
 
-	bill.Link = fmt.Sprintf("https://www.congress.gov/bill/116th-congress/house-bill/%d", bill.Number)
+	segment, ok := billTypePaths[bill.Type]
+	if !ok {
+		fail("billType", fmt.Errorf("unknown bill type %q", bill.Type))
+	}
 
-	if err = database.InsertBill(bill); err != nil {
-		panic(err.Error())
+	if failed {
+		return
 	}
+
+	bill.ID = fmt.Sprintf("%s%d", bill.Type, bill.Number)
+	bill.Link = fmt.Sprintf("https://www.congress.gov/bill/%s-congress/%s/%d", utility.Ordinal(bill.Congress), segment, bill.Number)
+
+	if err = store.UpsertBill(bill); err != nil {
+		fail("", err)
+		return
+	}
+	atomic.AddInt64(&stats.changed, 1)
 }
 
-// PopulateBills parses XML into bill documents and populates the collection in Mongo
-func PopulateBills() error {
-	matches, err := filepath.Glob("../../bills/*.xml")
+type billStats struct {
+	changed   int64
+	unchanged int64
+}
+
+// PopulateBills parses the XML in each directory into bill documents and upserts them
+// Directories may hold BILLSTATUS files from any congress, which is read from the files themselves
+func PopulateBills(store database.Store, dirs []string, report *Report) error {
+	hashes, err := store.GetBillHashes()
 	if err != nil {
 		return err
 	}
+	matches := []string{}
+	for _, dir := range dirs {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+		if err != nil {
+			return err
+		}
+		matches = append(matches, paths...)
+	}
 	throttle := make(chan struct{}, 16)
 	for i := 0; i < 16; i++ {
 		throttle <- struct{}{}
 	}
 	wg := sync.WaitGroup{}
+	stats := billStats{}
 	for _, path := range matches {
 		<-throttle
 		wg.Add(1)
-		go populateBill(path, throttle, &wg)
+		go populateBill(store, path, hashes, &stats, report, throttle, &wg)
 	}
 	wg.Wait()
-	return nil
+	fmt.Printf("%d bills added or changed, %d unchanged\n", stats.changed, stats.unchanged)
+	return store.Flush()
 }
@@ -2,86 +2,386 @@ package parse
 
 import (
 	"backend/internal/database"
+	"backend/pkg/utility"
 	"fmt"
+	"sort"
 	"strings"
-	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-// PartyID stores a member's party and ID in the context of their appearance
-// on a particular bill (e.g. Justin Amash's party will appear as R, I, and L)
+// PartyID stores a member's bioguide ID, the date they joined a particular bill and their party on that date
+// (e.g. Justin Amash's party will appear as R, I, and L depending on the date)
+// Original is set for sponsors and original cosponsors
 type PartyID struct {
-	Party byte
-	ID    int
+	Party    byte
+	ID       string
+	Date     time.Time
+	Original bool
 }
 
-func buildNameToIDMap() (map[string]int, error) {
-	nameToID := map[string]int{}
-	members, _, err := database.GetMembers(bson.M{})
+// buildResolver returns a resolver over a congress's members
+func buildResolver(store database.Store, overrides *Overrides, congress int) (*resolver, error) {
+	members, _, err := store.GetMembers(bson.M{"congress": congress})
 	if err != nil {
-		return nameToID, err
+		return nil, err
 	}
-	for _, m := range members {
-		for _, name := range m.FullStrings {
-			nameToID[name] = m.ID
+	m := map[string]*database.Member{}
+	for i := range members {
+		m[members[i].BioguideID] = &members[i]
+	}
+	return newResolver(congress, overrides, m), nil
+}
+
+// cellKey identifies a cell by its position and edge kind
+type cellKey struct {
+	position string
+	edges    string
+}
+
+// matrix holds a congress's adjacency cells in memory while bills are added and retracted
+// Only the edge kinds of the policy are built; stored cells of other kinds are emptied so the write deletes them
+// Cells are written back in a single bulk write once the congress is done
+type matrix struct {
+	congress int
+	kinds    map[string]bool
+	cells    map[cellKey]*database.Cell
+	changed  map[cellKey]bool
+}
+
+func newMatrix(congress int, kinds []string, cells []database.Cell) *matrix {
+	m := &matrix{
+		congress: congress,
+		kinds:    map[string]bool{},
+		cells:    map[cellKey]*database.Cell{},
+		changed:  map[cellKey]bool{},
+	}
+	for _, kind := range kinds {
+		m.kinds[kind] = true
+	}
+	for i := range cells {
+		key := cellKey{cells[i].Position, cells[i].Edges}
+		if cells[i].BillIDs == nil || !m.kinds[key.edges] {
+			cells[i].BillIDs = map[string]time.Time{}
+			m.changed[key] = true
+		}
+		if cells[i].Shares == nil {
+			cells[i].Shares = map[string]database.Share{}
 		}
+		m.cells[key] = &cells[i]
 	}
-	return nameToID, nil
+	return m
 }
 
-func updateCells(members []PartyID, billNumber int, throttle chan struct{}, wg *sync.WaitGroup) error {
-	defer func() {
-		throttle <- struct{}{}
-		wg.Done()
-	}()
+// missingKinds reports whether an edge kind of the policy was not built, as when the policy was widened
+// since the last run
+func (m *matrix) missingKinds(built []string) bool {
+	for kind := range m.kinds {
+		if !utility.Contains(built, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBills retracts the previous contributions of the supplied bills from every cell
+func (m *matrix) removeBills(billIDs map[string]bool) {
+	for key, cell := range m.cells {
+		for billID := range cell.BillIDs {
+			if billIDs[billID] {
+				delete(cell.BillIDs, billID)
+				delete(cell.Shares, billID)
+				m.changed[key] = true
+			}
+		}
+	}
+}
+
+// addBill adds a bill to the cell of every pair of its members whose edge kind the policy selects
+// A pair is a cross-party edge when the two held different parties on their dates of joining the bill
+// Each cell records the bill's share of its weights: the number of members and whether both were originals
+func (m *matrix) addBill(chamber string, members []PartyID, billID string) int {
+	pairs := 0
+	n := len(members)
 	for _, i := range members {
 		for _, j := range members {
-			if i.ID >= j.ID || i.Party == j.Party {
+			if i.ID >= j.ID {
 				continue
 			}
-			position := fmt.Sprintf("%d_%d", i.ID, j.ID)
-			filter := bson.M{"position": position}
-			update := bson.M{
-				"$setOnInsert": bson.M{
-					"position": position,
-				},
-				"$inc": bson.M{"count": 1},
-				"$set": bson.M{fmt.Sprintf("billNumbers.%d", billNumber): true},
+			edges := database.EdgesCross
+			if i.Party == j.Party {
+				edges = database.EdgesSame
 			}
-			if err := database.UpsertCell(filter, update); err != nil {
-				return err
+			if !m.kinds[edges] {
+				continue
+			}
+			key := cellKey{database.CellPosition(i.ID, j.ID), edges}
+			cell := m.cells[key]
+			if cell == nil {
+				cell = &database.Cell{
+					Congress: m.congress,
+					Chamber:  chamber,
+					Position: key.position,
+					Edges:    edges,
+					BillIDs:  map[string]time.Time{},
+					Shares:   map[string]database.Share{},
+				}
+				m.cells[key] = cell
+			}
+			// the pair shares the bill once the later of the two has signed on
+			date := i.Date
+			if j.Date.After(date) {
+				date = j.Date
+			}
+			cell.BillIDs[billID] = date
+			cell.Shares[billID] = database.Share{Members: n, Original: i.Original && j.Original}
+			m.changed[key] = true
+			pairs++
+		}
+	}
+	return pairs
+}
+
+// changedCells recomputes the count, weights, policy areas and subjects of each changed cell from the bills it
+// holds, returning the cells ordered by position and edge kind
+// Emptied cells are returned with a zero count so that the write deletes them
+func (m *matrix) changedCells(billMap map[string]database.Bill) []database.Cell {
+	keys := []cellKey{}
+	for key := range m.changed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].position != keys[j].position {
+			return keys[i].position < keys[j].position
+		}
+		return keys[i].edges < keys[j].edges
+	})
+	cells := []database.Cell{}
+	for _, key := range keys {
+		cell := m.cells[key]
+		policyAreas := map[string]bool{}
+		subjects := map[string]bool{}
+		for billID := range cell.BillIDs {
+			b := billMap[billID]
+			if b.PolicyArea != "" {
+				policyAreas[b.PolicyArea] = true
+			}
+			for _, subject := range b.Subjects {
+				if subject != "" {
+					subjects[subject] = true
+				}
 			}
 		}
+		cell.Tally()
+		cell.PolicyAreas = utility.Keys(policyAreas)
+		cell.Subjects = utility.Keys(subjects)
+		cells = append(cells, *cell)
 	}
-	return nil
+	return cells
 }
 
-// PopulateCells populates the cells of the adjacency matrix
-func PopulateCells() error {
-	nameToID, err := buildNameToIDMap()
+// Touched records, per congress, the bioguide IDs of members whose cells changed during a run
+// A nil Touched stands for every member of every congress
+type Touched map[int]map[string]bool
+
+func (t Touched) addPosition(congress int, position string) {
+	if t[congress] == nil {
+		t[congress] = map[string]bool{}
+	}
+	for _, bioguideID := range strings.Split(position, "_") {
+		t[congress][bioguideID] = true
+	}
+}
+
+// PopulateCells populates the cells of each congress's adjacency matrices with the edge kinds of the
+// policy: cross-party pairs, same-party pairs or all pairs, each stored as its own cell
+// Bills only carry members of their originating chamber, so each cell belongs to a single chamber
+// Members are identified as in PopulateMembers, and each bill's party counts are recomputed from the
+// parties its members held on their sponsorship dates
+// The directed network from each cosponsor to the bill's sponsor is maintained alongside the cells
+// A congress is rebuilt from all of its bills until its CellBuild records every kind of the policy and the network
+// The members of every changed cell are returned for recounting
+func PopulateCells(store database.Store, overrides *Overrides, edges string, report *Report) (Touched, error) {
+	touched := Touched{}
+	kinds, err := database.EdgeKinds(edges)
 	if err != nil {
-		return err
+		return touched, err
+	}
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return touched, err
+	}
+	for _, congress := range congresses {
+		positions, err := populateCongressCells(store, overrides, congress, kinds, report)
+		if err != nil {
+			return touched, err
+		}
+		for _, position := range positions {
+			touched.addPosition(congress, position)
+		}
 	}
-	bills, err := database.GetBills(bson.M{"multiParty": true})
+	return touched, nil
+}
+
+// partyID resolves a member's appearance on a bill to their bioguide ID and their party on the date
+func partyID(r *resolver, b database.Bill, s database.Sponsor, date time.Time) (PartyID, error) {
+	bioguideID, err := r.resolve(b.ID, b.Chamber(), s)
 	if err != nil {
+		return PartyID{}, err
+	}
+	member := r.members[bioguideID]
+	if member == nil {
+		return PartyID{}, fmt.Errorf("no member found for %q (bioguide ID %q)", s.Name, bioguideID)
+	}
+	party := member.PartyAt(date)
+	if party == "" {
+		return PartyID{}, fmt.Errorf("no party known for %q on %s", s.Name, date.Format(dateLayout))
+	}
+	return PartyID{Party: party[0], ID: bioguideID, Date: date}, nil
+}
+
+// updateBillParties stores the party in effect on each appearance and the counts aggregated from them
+func updateBillParties(store database.Store, b *database.Bill) error {
+	if err := aggregate(b); err != nil {
 		return err
 	}
-	throttle := make(chan struct{}, 16)
-	for i := 0; i < 16; i++ {
-		throttle <- struct{}{}
+	filter := bson.M{"congress": b.Congress, "id": b.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"sponsors":   b.Sponsors,
+			"cosponsors": b.Cosponsors,
+			"score":      b.Score,
+			"numDems":    b.NumDems,
+			"numReps":    b.NumReps,
+			"numInds":    b.NumInds,
+			"numLibs":    b.NumLibs,
+			"multiParty": b.MultiParty,
+		},
+	}
+	return store.UpdateBill(filter, update)
+}
+
+func populateCongressCells(store database.Store, overrides *Overrides, congress int, kinds []string, report *Report) ([]string, error) {
+	r, err := buildResolver(store, overrides, congress)
+	if err != nil {
+		return nil, err
+	}
+	bills, err := store.GetBills(bson.M{"congress": congress})
+	if err != nil {
+		return nil, err
+	}
+	if len(bills) == 0 {
+		return nil, nil
+	}
+	start := time.Now()
+	var cells []database.Cell
+	for _, kind := range []string{database.EdgesCross, database.EdgesSame} {
+		kindCells, err := store.GetCells(congress, bson.M{"edges": kind}, nil, database.Window{})
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, kindCells...)
+	}
+	m := newMatrix(congress, kinds, cells)
+	storedEdges, err := store.GetEdges(congress, bson.M{}, database.Window{})
+	if err != nil {
+		return nil, err
 	}
-	wg := sync.WaitGroup{}
+	n := newNetwork(congress, storedEdges)
+	build, err := store.GetCellBuild(congress)
+	if err != nil {
+		return nil, err
+	}
+	rebuild := m.missingKinds(build.Kinds) || !build.Edges
+	billMap := map[string]database.Bill{}
+	pending := []database.Bill{}
+	pendingIDs := map[string]bool{}
 	for _, b := range bills {
+		billMap[b.ID] = b
+		if rebuild || utility.Contains(b.Pending, database.StageCells) {
+			pending = append(pending, b)
+			pendingIDs[b.ID] = true
+		}
+	}
+	if len(pending) == 0 && len(m.changed) == 0 && len(n.changed) == 0 {
+		return nil, nil
+	}
+	m.removeBills(pendingIDs)
+	n.removeBills(pendingIDs)
+	pairs := 0
+	processed := []string{}
+	for _, b := range pending {
 		members := []PartyID{}
-		for _, s := range append(b.Sponsors, b.Cosponsors...) {
-			party := strings.Split(s, "[")[1][0]
-			members = append(members, PartyID{party, nameToID[s]})
+		sponsors := []PartyID{}
+		cosponsors := []PartyID{}
+		var errs []error
+		for i, s := range b.Sponsors {
+			member, err := partyID(r, b, s, b.Introduced)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			b.Sponsors[i].Party = string(member.Party)
+			member.Original = true
+			members = append(members, member)
+			sponsors = append(sponsors, member)
 		}
-		<-throttle
-		wg.Add(1)
-		go updateCells(members, b.Number, throttle, &wg)
+		for i, c := range b.Cosponsors {
+			member, err := partyID(r, b, database.Sponsor{Name: c.Name, BioguideID: c.BioguideID}, c.Date)
+			if err != nil {
+				// a withdrawn cosponsor keeps the party shown in their full string
+				if !c.Withdrawn() {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			b.Cosponsors[i].Party = string(member.Party)
+			member.Original = c.Original
+			if !c.Withdrawn() {
+				members = append(members, member)
+				cosponsors = append(cosponsors, member)
+			}
+		}
+		if len(errs) == 0 {
+			if err := updateBillParties(store, &b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			for _, err := range errs {
+				report.Add(Issue{
+					Stage:  "cells",
+					Record: fmt.Sprintf("%d %s", congress, b.ID),
+					Reason: err.Error(),
+				})
+			}
+			continue
+		}
+		pairs += m.addBill(b.Chamber(), members, b.ID)
+		n.addBill(b.Chamber(), sponsors, cosponsors, b.ID)
+		processed = append(processed, b.ID)
+	}
+	changed := m.changedCells(billMap)
+	if err := store.ReplaceCells(changed); err != nil {
+		return nil, err
+	}
+	edges := n.changedEdges()
+	if err := store.ReplaceEdges(edges); err != nil {
+		return nil, err
+	}
+	if err := store.ReplaceCellBuild(database.CellBuild{Congress: congress, Kinds: kinds, Edges: true}); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+	written := len(changed) + len(edges)
+	fmt.Printf("%s congress: %d bills, %d member pairs, %d cells and %d directed edges written in %s (%.0f documents/s)\n",
+		utility.Ordinal(congress), len(pending), pairs, len(changed), len(edges), elapsed.Round(time.Millisecond), float64(written)/elapsed.Seconds())
+	positions := make([]string, len(changed))
+	for i, cell := range changed {
+		positions[i] = cell.Position
 	}
-	wg.Wait()
-	return nil
+	// bills with errors stay pending so the next run retries them
+	done := bson.M{"congress": congress, "id": bson.M{"$in": processed}, "pending": database.StageCells}
+	return positions, store.ClearPending(done, database.StageCells)
 }
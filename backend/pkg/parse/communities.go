@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/graph"
+	"backend/pkg/utility"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PopulateCommunities assigns each member to a community found by Louvain detection over every stored
+// cell of their chamber, so that blocs may span party lines where cross-party cells are strong
+// Each chamber is partitioned apart, and the Senate's communities are numbered on from the House's
+func PopulateCommunities(store database.Store, touched Touched, report *Report) error {
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return err
+	}
+	for _, congress := range congresses {
+		if touched != nil && len(touched[congress]) == 0 {
+			continue
+		}
+		offset := 0
+		for _, chamber := range []string{database.House, database.Senate} {
+			g, err := graph.Load(store, congress, chamber, database.EdgesAll, database.WeightCount)
+			if err != nil {
+				return err
+			}
+			communities := g.Louvain()
+			count := 0
+			for i, bioguideID := range g.Nodes {
+				if communities[i] > count {
+					count = communities[i]
+				}
+				community := communities[i]
+				if community > 0 {
+					community += offset
+				}
+				filter := bson.M{"congress": congress, "bioguideId": bioguideID}
+				update := bson.M{
+					"$set": bson.M{
+						"community": community,
+					},
+				}
+				if err := store.UpdateMember(filter, update); err != nil {
+					report.Add(Issue{
+						Stage:  "communities",
+						Record: fmt.Sprintf("%d %s", congress, bioguideID),
+						Reason: err.Error(),
+					})
+				}
+			}
+			offset += count
+			fmt.Printf("%s congress %s: %d communities, modularity %.3f\n", utility.Ordinal(congress), chamber, count, g.Modularity(communities))
+		}
+	}
+	return store.Flush()
+}
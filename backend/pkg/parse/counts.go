@@ -10,54 +10,64 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func setCounts(m database.Member, throttle chan struct{}, wg *sync.WaitGroup) {
+func setCounts(store database.Store, m database.Member, report *Report, throttle chan struct{}, wg *sync.WaitGroup) {
 	defer func() {
 		throttle <- struct{}{}
 		wg.Done()
 	}()
 
+	fail := func(err error) {
+		report.Add(Issue{
+			Stage:  "counts",
+			Record: fmt.Sprintf("%d %s", m.Congress, m.Name),
+			Reason: err.Error(),
+		})
+	}
+
 	counts := map[string]int{}
 	patterns := []string{
-		fmt.Sprintf("^%d_", m.ID),
-		fmt.Sprintf("_%d$", m.ID),
+		fmt.Sprintf("^%s_", m.BioguideID),
+		fmt.Sprintf("_%s$", m.BioguideID),
 	}
 
 	for i, pattern := range patterns {
 		filter := bson.M{
+			"edges": database.EdgesCross,
 			"position": bson.M{
 				"$regex": primitive.Regex{Pattern: pattern, Options: "i"},
 			},
 		}
-		cells, err := database.GetCells(filter, nil)
+		cells, err := store.GetCells(m.Congress, filter, nil, database.Window{})
 		if err != nil {
-			panic(err.Error())
+			fail(err)
+			return
 		}
 
 		for _, c := range cells {
 			var id string
 			if i == 0 {
-				id = strings.Replace(c.Position, fmt.Sprintf("%d_", m.ID), "", 1)
+				id = strings.TrimPrefix(c.Position, m.BioguideID+"_")
 			} else {
-				id = strings.Replace(c.Position, fmt.Sprintf("_%d", m.ID), "", 1)
+				id = strings.TrimSuffix(c.Position, "_"+m.BioguideID)
 			}
 			counts[id] = c.Count
 		}
 	}
 
-	filter := bson.M{"id": m.ID}
+	filter := bson.M{"congress": m.Congress, "bioguideId": m.BioguideID}
 	update := bson.M{
 		"$set": bson.M{
 			"counts": counts,
 		},
 	}
-	if err := database.UpdateMember(filter, update); err != nil {
-		panic(err.Error())
+	if err := store.UpdateMember(filter, update); err != nil {
+		fail(err)
 	}
 }
 
-// PopulateCounts maps member IDs to number of bills cosponsored
-func PopulateCounts() error {
-	members, _, err := database.GetMembers(bson.M{})
+// PopulateCounts maps member bioguide IDs to number of bills cosponsored across party lines within each congress
+func PopulateCounts(store database.Store, touched Touched, report *Report) error {
+	members, _, err := store.GetMembers(bson.M{})
 	if err != nil {
 		return err
 	}
@@ -67,10 +77,13 @@ func PopulateCounts() error {
 	}
 	wg := sync.WaitGroup{}
 	for _, m := range members {
+		if touched != nil && !touched[m.Congress][m.BioguideID] {
+			continue
+		}
 		<-throttle
 		wg.Add(1)
-		go setCounts(m, throttle, &wg)
+		go setCounts(store, m, report, throttle, &wg)
 	}
 	wg.Wait()
-	return nil
+	return store.Flush()
 }
@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"sort"
+	"time"
+)
+
+// edgeKey identifies a directed edge by its source and target
+type edgeKey struct {
+	source string
+	target string
+}
+
+// network holds a congress's directed sponsor network in memory while bills are added and retracted
+// Edges run from each cosponsor to the sponsor of the bill, and are written back in a single bulk write
+type network struct {
+	congress int
+	edges    map[edgeKey]*database.Edge
+	changed  map[edgeKey]bool
+}
+
+func newNetwork(congress int, edges []database.Edge) *network {
+	n := &network{congress: congress, edges: map[edgeKey]*database.Edge{}, changed: map[edgeKey]bool{}}
+	for i := range edges {
+		if edges[i].BillIDs == nil {
+			edges[i].BillIDs = map[string]time.Time{}
+		}
+		n.edges[edgeKey{edges[i].Source, edges[i].Target}] = &edges[i]
+	}
+	return n
+}
+
+// removeBills retracts the previous contributions of the supplied bills from every edge
+func (n *network) removeBills(billIDs map[string]bool) {
+	for key, edge := range n.edges {
+		for billID := range edge.BillIDs {
+			if billIDs[billID] {
+				delete(edge.BillIDs, billID)
+				n.changed[key] = true
+			}
+		}
+	}
+}
+
+// addBill adds an edge from each active cosponsor of a bill to each of its sponsors, dated when the cosponsor joined
+func (n *network) addBill(chamber string, sponsors, cosponsors []PartyID, billID string) int {
+	added := 0
+	for _, c := range cosponsors {
+		for _, s := range sponsors {
+			if c.ID == s.ID {
+				continue
+			}
+			key := edgeKey{c.ID, s.ID}
+			edge := n.edges[key]
+			if edge == nil {
+				edge = &database.Edge{
+					Congress: n.congress,
+					Chamber:  chamber,
+					Source:   c.ID,
+					Target:   s.ID,
+					BillIDs:  map[string]time.Time{},
+				}
+				n.edges[key] = edge
+			}
+			edge.BillIDs[billID] = c.Date
+			n.changed[key] = true
+			added++
+		}
+	}
+	return added
+}
+
+// changedEdges recomputes the count of each changed edge, returning the edges ordered by source and target
+// Emptied edges are returned with a zero count so that the write deletes them
+func (n *network) changedEdges() []database.Edge {
+	keys := []edgeKey{}
+	for key := range n.changed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].target < keys[j].target
+	})
+	edges := []database.Edge{}
+	for _, key := range keys {
+		edge := n.edges[key]
+		edge.Count = len(edge.BillIDs)
+		edges = append(edges, *edge)
+	}
+	return edges
+}
@@ -0,0 +1,165 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/utility"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Overrides are manual identity decisions checked in alongside the code
+// They take precedence over the bioguide ID in the source and over the name heuristics
+type Overrides struct {
+	Merges []Merge `json:"merges"`
+	Splits []Split `json:"splits"`
+}
+
+// Merge assigns every appearance of the listed full strings to one member
+// A zero congress applies the merge to every congress
+type Merge struct {
+	Congress int      `json:"congress,omitempty"`
+	Names    []string `json:"names"`
+	MemberID string   `json:"memberId"`
+}
+
+// Split assigns the appearances of a full string on the listed bills to a different member
+type Split struct {
+	Congress int      `json:"congress"`
+	Name     string   `json:"name"`
+	Bills    []string `json:"bills"`
+	MemberID string   `json:"memberId"`
+}
+
+// LoadOverrides reads the overrides file at path
+// A missing file is treated as having no overrides
+func LoadOverrides(path string) (*Overrides, error) {
+	overrides := &Overrides{}
+	if path == "" {
+		return overrides, nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return overrides, nil
+	} else if err != nil {
+		return overrides, err
+	}
+	if err := json.Unmarshal(bs, overrides); err != nil {
+		return overrides, fmt.Errorf("bad overrides file %s: %v", path, err)
+	}
+	for _, m := range overrides.Merges {
+		if _, err := database.MemberIndex(m.MemberID); err != nil {
+			return overrides, fmt.Errorf("bad merge in %s: %v", path, err)
+		}
+	}
+	for _, s := range overrides.Splits {
+		if _, err := database.MemberIndex(s.MemberID); err != nil {
+			return overrides, fmt.Errorf("bad split in %s: %v", path, err)
+		}
+	}
+	return overrides, nil
+}
+
+// resolver maps the appearances of sponsors on a congress's bills to members
+type resolver struct {
+	congress  int
+	overrides *Overrides
+	members   map[string]*database.Member
+}
+
+func newResolver(congress int, overrides *Overrides, members map[string]*database.Member) *resolver {
+	if overrides == nil {
+		overrides = &Overrides{}
+	}
+	return &resolver{congress: congress, overrides: overrides, members: members}
+}
+
+// direct returns the member named by an override or by the source's bioguide ID
+func (r *resolver) direct(billID string, s database.Sponsor) (string, bool) {
+	for _, split := range r.overrides.Splits {
+		if split.Congress == r.congress && split.Name == s.Name && utility.Contains(split.Bills, billID) {
+			return split.MemberID, true
+		}
+	}
+	for _, merge := range r.overrides.Merges {
+		if (merge.Congress == 0 || merge.Congress == r.congress) && utility.Contains(merge.Names, s.Name) {
+			return merge.MemberID, true
+		}
+	}
+	if s.BioguideID != "" {
+		return s.BioguideID, true
+	}
+	return "", false
+}
+
+// lastName returns the surname of a "Last, First" display name
+func lastName(name string) string {
+	return strings.TrimSpace(strings.SplitN(name, ",", 2)[0])
+}
+
+// resolve returns the bioguide ID of the member behind an appearance
+// Appearances without a direct identity are matched against known members of the chamber by
+// name, state and district, falling back to surname so a changed middle initial or suffix still matches
+func (r *resolver) resolve(billID, chamber string, s database.Sponsor) (string, error) {
+	if id, ok := r.direct(billID, s); ok {
+		return id, nil
+	}
+	tokens := strings.Split(s.Name, " [")
+	if len(tokens) != 2 {
+		return "", fmt.Errorf("no bioguide ID for %q and no name to match", s.Name)
+	}
+	name := tokens[0]
+	_, state, district, err := parsePSD(tokens[1])
+	if err != nil {
+		return "", err
+	}
+	exact := []string{}
+	surname := []string{}
+	for id, m := range r.members {
+		if m.Chamber != chamber || m.State != state {
+			continue
+		}
+		if district != "" && !utility.Contains(m.Districts, district) {
+			continue
+		}
+		if m.Name == name || utility.Contains(m.FullStrings, s.Name) {
+			exact = append(exact, id)
+		} else if lastName(m.Name) == lastName(name) {
+			surname = append(surname, id)
+		}
+	}
+	for _, candidates := range [][]string{exact, surname} {
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			return candidates[0], nil
+		}
+		sort.Strings(candidates)
+		return "", fmt.Errorf("no bioguide ID for %q and it matches several members: %s", s.Name, strings.Join(candidates, ", "))
+	}
+	return "", fmt.Errorf("no bioguide ID for %q and it matches no known member", s.Name)
+}
+
+// sharedNames reports display names held by more than one member of a congress
+// Such members are kept apart by bioguide ID but are worth checking by hand
+func sharedNames(congress int, members map[string]*database.Member, report *Report) {
+	byName := map[string][]string{}
+	for id, m := range members {
+		byName[m.Name] = append(byName[m.Name], id)
+	}
+	for name, ids := range byName {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Strings(ids)
+		report.Add(Issue{
+			Stage:  "identity",
+			Record: fmt.Sprintf("%d %s", congress, name),
+			Reason: fmt.Sprintf("name is shared by members %s, which are kept separate", strings.Join(ids, ", ")),
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/utility"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIdentity(t *testing.T) {
+	store := database.NewMemory()
+	populate(t, store, fixtures(t))
+
+	members, _, err := store.GetMembers(bson.M{"congress": 116})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, m := range members {
+		ids = append(ids, m.Chamber+" "+m.BioguideID)
+	}
+	// the merge keeps C999999 from the source out, and the split adds D000007
+	want := "house A000001,house A000004,house B000002,house C000003,house D000007,senate S000005,senate T000006"
+	if got := strings.Join(ids, ","); got != want {
+		t.Errorf("members = %s", got)
+	}
+
+	// Adams appears without a bioguide ID on hr2 by name and on hr3 with a middle initial
+	adams := member(t, store, "A000001")
+	if !reflect.DeepEqual(adams.FullStrings, []string{"Adams, Ann [D-CA-1]", "Adams, Ann B. [D-CA-1]"}) ||
+		adams.ID != 1000001 || adams.State != "CA" || !reflect.DeepEqual(adams.Districts, []string{"1"}) {
+		t.Errorf("A000001 = %+v", adams)
+	}
+	if cole := member(t, store, "C000003"); !utility.Contains(cole.FullStrings, "Cole, Calvin [R-OH-3]") {
+		t.Errorf("C000003 full strings = %v", cole.FullStrings)
+	}
+	if split := member(t, store, "D000007"); split.Name != "Cole, Cal" || split.State != "OH" {
+		t.Errorf("D000007 = %+v", split)
+	}
+	if senator := member(t, store, "S000005"); senator.Chamber != database.Senate || len(senator.Districts) != 0 {
+		t.Errorf("S000005 = %+v", senator)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	members := map[string]*database.Member{
+		"A000001": {BioguideID: "A000001", Chamber: database.House, Name: "Adams, Ann", State: "CA", Districts: []string{"1"}},
+		"A000002": {BioguideID: "A000002", Chamber: database.House, Name: "Adams, Al", State: "CA", Districts: []string{"1", "2"}},
+		"A000003": {BioguideID: "A000003", Chamber: database.Senate, Name: "Adams, Ann", State: "CA"},
+	}
+	overrides := &Overrides{
+		Merges: []Merge{{Congress: 115, Names: []string{"Adams, Ann [D-CA-1]"}, MemberID: "A000009"}},
+		Splits: []Split{{Congress: 116, Name: "Adams, Al [D-CA-2]", Bills: []string{"hr2"}, MemberID: "A000008"}},
+	}
+	r := newResolver(116, overrides, members)
+	for _, test := range []struct {
+		billID  string
+		chamber string
+		name    string
+		want    string
+		err     string
+	}{
+		// the merge belongs to another congress
+		{"hr1", database.House, "Adams, Ann [D-CA-1]", "A000001", ""},
+		{"s1", database.Senate, "Adams, Ann [D-CA]", "A000003", ""},
+		{"hr1", database.House, "Adams, Al [D-CA-2]", "A000002", ""},
+		{"hr2", database.House, "Adams, Al [D-CA-2]", "A000008", ""},
+		{"hr1", database.House, "Adams, A. [D-CA-2]", "A000002", ""},
+		{"hr1", database.House, "Adams, Amy [D-CA-1]", "", "matches several members: A000001, A000002"},
+		{"hr1", database.House, "Adams, Ann [D-CA-3]", "", "matches no known member"},
+		{"hr1", database.House, "Adams, Ann", "", "no name to match"},
+	} {
+		id, err := r.resolve(test.billID, test.chamber, database.Sponsor{Name: test.name})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s on %s resolved to %q, %v", test.name, test.billID, id, err)
+			}
+		} else if err != nil || id != test.want {
+			t.Errorf("%s on %s resolved to %q, %v, want %s", test.name, test.billID, id, err, test.want)
+		}
+	}
+	if id, err := newResolver(115, overrides, members).resolve("hr1", database.House, database.Sponsor{Name: "Adams, Ann [D-CA-1]", BioguideID: "A000001"}); err != nil || id != "A000009" {
+		t.Errorf("merge resolved to %q, %v", id, err)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	if overrides, err := LoadOverrides(filepath.Join(dir, "missing.json")); err != nil || len(overrides.Merges) != 0 {
+		t.Errorf("missing file loaded %+v, %v", overrides, err)
+	}
+	for name, test := range map[string]struct {
+		json string
+		err  string
+	}{
+		"good.json":  {`{"merges": [{"names": ["Adams, Ann [D-CA-1]"], "memberId": "A000001"}], "splits": []}`, ""},
+		"bad.json":   {`{"merges": [`, "bad overrides file"},
+		"merge.json": {`{"merges": [{"names": ["Adams, Ann [D-CA-1]"], "memberId": "Adams"}]}`, "bad merge"},
+		"split.json": {`{"splits": [{"congress": 116, "name": "Adams, Ann [D-CA-1]", "bills": ["hr1"], "memberId": ""}]}`, "bad split"},
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(test.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		overrides, err := LoadOverrides(path)
+		if test.err == "" {
+			if err != nil || len(overrides.Merges) != 1 || overrides.Merges[0].MemberID != "A000001" {
+				t.Errorf("%s loaded %+v, %v", name, overrides, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s returned %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v2"
+)
+
+// legislator is an entry of the unitedstates/congress-legislators data
+// The current, historical and social media files all share this shape, each filling different fields
+type legislator struct {
+	ID struct {
+		Bioguide string `yaml:"bioguide" json:"bioguide"`
+	} `yaml:"id" json:"id"`
+	Name struct {
+		OfficialFull string `yaml:"official_full" json:"official_full"`
+	} `yaml:"name" json:"name"`
+	Bio struct {
+		Birthday string `yaml:"birthday" json:"birthday"`
+		Gender   string `yaml:"gender" json:"gender"`
+	} `yaml:"bio" json:"bio"`
+	Terms []struct {
+		Type     string `yaml:"type" json:"type"`
+		Start    string `yaml:"start" json:"start"`
+		End      string `yaml:"end" json:"end"`
+		State    string `yaml:"state" json:"state"`
+		District *int   `yaml:"district" json:"district"`
+		Party    string `yaml:"party" json:"party"`
+		// PartyAffiliations records a change of party during the term
+		PartyAffiliations []struct {
+			Start string `yaml:"start" json:"start"`
+			End   string `yaml:"end" json:"end"`
+			Party string `yaml:"party" json:"party"`
+		} `yaml:"party_affiliations" json:"party_affiliations"`
+	} `yaml:"terms" json:"terms"`
+	LeadershipRoles []struct {
+		Title   string `yaml:"title" json:"title"`
+		Chamber string `yaml:"chamber" json:"chamber"`
+		Start   string `yaml:"start" json:"start"`
+		End     string `yaml:"end" json:"end"`
+	} `yaml:"leadership_roles" json:"leadership_roles"`
+	Social map[string]interface{} `yaml:"social" json:"social"`
+}
+
+// merge fills the fields of l that another file supplied
+func (l *legislator) merge(other legislator) {
+	if l.Name.OfficialFull == "" {
+		l.Name = other.Name
+	}
+	if l.Bio.Birthday == "" && l.Bio.Gender == "" {
+		l.Bio = other.Bio
+	}
+	l.Terms = append(l.Terms, other.Terms...)
+	l.LeadershipRoles = append(l.LeadershipRoles, other.LeadershipRoles...)
+	if l.Social == nil {
+		l.Social = other.Social
+	}
+}
+
+// readLegislators reads every YAML and JSON file in dir, keyed by bioguide ID
+func readLegislators(dir string) (map[string]*legislator, error) {
+	legislators := map[string]*legislator{}
+	paths := []string{}
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return legislators, err
+		}
+		paths = append(paths, matches...)
+	}
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return legislators, err
+		}
+		var entries []legislator
+		if filepath.Ext(path) == ".json" {
+			// numbers such as twitter_id are kept intact rather than read as floats
+			dec := json.NewDecoder(bytes.NewReader(bs))
+			dec.UseNumber()
+			err = dec.Decode(&entries)
+		} else {
+			err = yaml.Unmarshal(bs, &entries)
+		}
+		if err != nil {
+			return legislators, fmt.Errorf("unable to read %s: %v", path, err)
+		}
+		for _, entry := range entries {
+			if entry.ID.Bioguide == "" {
+				continue
+			}
+			if l, ok := legislators[entry.ID.Bioguide]; ok {
+				l.merge(entry)
+			} else {
+				e := entry
+				legislators[entry.ID.Bioguide] = &e
+			}
+		}
+	}
+	return legislators, nil
+}
+
+// district converts a congress-legislators district number to the form used in BILLSTATUS
+func district(n *int) string {
+	switch {
+	case n == nil:
+		return ""
+	case *n == 0:
+		return "At Large"
+	}
+	return strconv.Itoa(*n)
+}
+
+// biography converts a legislator entry to the member fields it supplies
+func biography(l *legislator) (bson.M, error) {
+	fields := bson.M{}
+	if l.Name.OfficialFull != "" {
+		fields["officialName"] = l.Name.OfficialFull
+	}
+	if l.Bio.Birthday != "" {
+		birthday, err := parseDate(l.Bio.Birthday)
+		if err != nil {
+			return fields, fmt.Errorf("bad birthday: %v", err)
+		}
+		fields["birthday"] = birthday
+	}
+	if l.Bio.Gender != "" {
+		fields["gender"] = l.Bio.Gender
+	}
+	if len(l.Terms) > 0 {
+		terms := []database.Term{}
+		history := []database.PartyInterval{}
+		sort.Slice(l.Terms, func(i, j int) bool {
+			return l.Terms[i].Start < l.Terms[j].Start
+		})
+		for _, t := range l.Terms {
+			start, err := parseDate(t.Start)
+			if err != nil {
+				return fields, fmt.Errorf("bad term start: %v", err)
+			}
+			end, err := parseDate(t.End)
+			if err != nil {
+				return fields, fmt.Errorf("bad term end: %v", err)
+			}
+			terms = append(terms, database.Term{
+				Type:     t.Type,
+				Start:    start,
+				End:      end,
+				State:    t.State,
+				District: district(t.District),
+				Party:    t.Party,
+			})
+			if len(t.PartyAffiliations) == 0 {
+				history = appendInterval(history, database.PartyInterval{Party: partyLetter(t.Party), Start: start, End: &end})
+				continue
+			}
+			for _, a := range t.PartyAffiliations {
+				start, err := parseDate(a.Start)
+				if err != nil {
+					return fields, fmt.Errorf("bad party affiliation start: %v", err)
+				}
+				end, err := parseDate(a.End)
+				if err != nil {
+					return fields, fmt.Errorf("bad party affiliation end: %v", err)
+				}
+				history = appendInterval(history, database.PartyInterval{Party: partyLetter(a.Party), Start: start, End: &end})
+			}
+		}
+		fields["terms"] = terms
+		fields["partyHistory"] = history
+	}
+	if len(l.LeadershipRoles) > 0 {
+		roles := []database.LeadershipRole{}
+		for _, r := range l.LeadershipRoles {
+			role := database.LeadershipRole{Title: r.Title, Chamber: r.Chamber}
+			start, err := parseDate(r.Start)
+			if err != nil {
+				return fields, fmt.Errorf("bad leadership role start: %v", err)
+			}
+			role.Start = start
+			if r.End != "" {
+				end, err := parseDate(r.End)
+				if err != nil {
+					return fields, fmt.Errorf("bad leadership role end: %v", err)
+				}
+				role.End = &end
+			}
+			roles = append(roles, role)
+		}
+		fields["leadershipRoles"] = roles
+	}
+	if len(l.Social) > 0 {
+		social := map[string]string{}
+		for k, v := range l.Social {
+			social[k] = fmt.Sprint(v)
+		}
+		fields["social"] = social
+	}
+	return fields, nil
+}
+
+// PopulateLegislators enriches members with biographical data from a local copy of the
+// unitedstates/congress-legislators YAML or JSON files in dir
+// Every congress's document for a member receives the same data
+// Terms and their party affiliations replace the party history derived from bills, and the
+// bills of members whose history changed are queued for the cells stage
+func PopulateLegislators(store database.Store, dir string, report *Report) error {
+	legislators, err := readLegislators(dir)
+	if err != nil {
+		return err
+	}
+	if len(legislators) == 0 {
+		fmt.Printf("No legislator data found in %s\n", dir)
+		return nil
+	}
+	_, memberMap, err := store.GetMembers(bson.M{})
+	if err != nil {
+		return err
+	}
+	enriched := 0
+	for bioguideID, m := range memberMap {
+		fail := func(reason string) {
+			report.Add(Issue{
+				Stage:  "legislators",
+				Record: fmt.Sprintf("%s %s", bioguideID, m.Name),
+				Reason: reason,
+			})
+		}
+		l, ok := legislators[bioguideID]
+		if !ok {
+			fail("not found in the legislator data")
+			continue
+		}
+		fields, err := biography(l)
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+		if err := store.UpdateMembers(bson.M{"bioguideId": bioguideID}, bson.M{"$set": fields}); err != nil {
+			fail(err.Error())
+			continue
+		}
+		if history, ok := fields["partyHistory"].([]database.PartyInterval); ok && !sameHistory(history, m.PartyHistory) {
+			if err := markMemberBills(store, 0, bioguideID); err != nil {
+				return err
+			}
+		}
+		enriched++
+	}
+	fmt.Printf("%d of %d members enriched\n", enriched, len(memberMap))
+	return store.Flush()
+}
@@ -3,55 +3,240 @@ package parse
 import (
 	"backend/internal/database"
 	"backend/pkg/utility"
+	"fmt"
 	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
-func parsePSD(s string) (string, string, string) {
+// parsePSD splits a party-state-district suffix such as D-CA-12 or, for senators, D-CA
+func parsePSD(s string) (string, string, string, error) {
 	tokens := strings.Split(strings.TrimRight(s, "]"), "-")
-	return tokens[0], tokens[1], tokens[2]
+	switch len(tokens) {
+	case 2:
+		return tokens[0], tokens[1], "", nil
+	case 3:
+		return tokens[0], tokens[1], tokens[2], nil
+	}
+	return "", "", "", fmt.Errorf("malformed party-state-district %q", s)
+}
+
+func appendDistrict(districts []string, district string) []string {
+	if district == "" || utility.Contains(districts, district) {
+		return districts
+	}
+	return append(districts, district)
+}
+
+// PopulateMembers populates each congress's members from the sponsors and cosponsors of its bills
+// Sponsors are identified by the overrides, their bioguide ID or, failing both, by name; appearances
+// that cannot be identified and names shared by several members are recorded in the report
+// Dated party histories are derived from the parties shown on each member's appearances
+func PopulateMembers(store database.Store, overrides *Overrides, report *Report) error {
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return err
+	}
+	for _, congress := range congresses {
+		if err := populateCongressMembers(store, overrides, congress, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appearance is a sponsor's appearance on a bill
+type appearance struct {
+	billID  string
+	chamber string
+	sponsor database.Sponsor
 }
 
-// PopulateMembers populates the members collection from information in bills collection
-func PopulateMembers() error {
-	names, err := database.GetSponsors()
+// populateCongressMembers adds the sponsors of a congress's pending bills to its members
+// Members are keyed by bioguide ID, from which their ID is derived, so both survive a rebuild
+func populateCongressMembers(store database.Store, overrides *Overrides, congress int, report *Report) error {
+	pending := bson.M{"congress": congress, "pending": database.StageMembers}
+	bills, err := store.GetBills(pending)
+	if err != nil {
+		return err
+	}
+	if len(bills) == 0 {
+		return nil
+	}
+
+	existing, _, err := store.GetMembers(bson.M{"congress": congress})
 	if err != nil {
 		return err
 	}
 
 	m := map[string]*database.Member{}
-	id := 1
+	for i := range existing {
+		member := &existing[i]
+		m[member.BioguideID] = member
+	}
+	r := newResolver(congress, overrides, m)
+
+	added := map[string]bool{}
+	updated := map[string]bool{}
 
-	for s := range names {
+	addAppearance := func(bioguideID, chamber, s string) {
+		fail := func(reason string) {
+			report.Add(Issue{
+				Stage:  "members",
+				Record: fmt.Sprintf("%d %s", congress, s),
+				Reason: reason,
+			})
+		}
 		tokens := strings.Split(s, " [")
+		if len(tokens) != 2 {
+			fail("expected a name followed by a bracketed party-state-district")
+			return
+		}
 		name := tokens[0]
-		if member, ok := m[name]; !ok {
-			party, state, district := parsePSD(tokens[1])
-			m[name] = &database.Member{
+		party, state, district, err := parsePSD(tokens[1])
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		id, err := database.MemberIndex(bioguideID)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		if member, ok := m[bioguideID]; !ok {
+			m[bioguideID] = &database.Member{
+				Congress:    congress,
+				BioguideID:  bioguideID,
 				ID:          id,
+				Chamber:     chamber,
 				Name:        name,
 				Parties:     []string{party},
-				Districts:   []string{district},
+				Districts:   appendDistrict([]string{}, district),
 				State:       state,
 				FullStrings: []string{s},
 			}
-			id++
+			added[bioguideID] = true
 		} else {
 			if !utility.Contains(member.FullStrings, s) {
-				party, _, district := parsePSD(tokens[1])
 				if !utility.Contains(member.Parties, party) {
 					member.Parties = append(member.Parties, party)
 				}
-				if !utility.Contains(member.Districts, district) {
-					member.Districts = append(member.Districts, district)
-				}
+				member.Districts = appendDistrict(member.Districts, district)
 				member.FullStrings = append(member.FullStrings, s)
+				if !added[bioguideID] {
+					updated[bioguideID] = true
+				}
 			}
 		}
 	}
 
+	// withdrawn cosponsors are still members of the chamber
+	// directly identified appearances go first so that the rest can be matched against them
+	unidentified := []appearance{}
+	for _, b := range bills {
+		sponsors := append([]database.Sponsor{}, b.Sponsors...)
+		for _, c := range b.Cosponsors {
+			sponsors = append(sponsors, database.Sponsor{Name: c.Name, BioguideID: c.BioguideID})
+		}
+		for _, sponsor := range sponsors {
+			if bioguideID, ok := r.direct(b.ID, sponsor); ok {
+				addAppearance(bioguideID, b.Chamber(), sponsor.Name)
+			} else {
+				unidentified = append(unidentified, appearance{b.ID, b.Chamber(), sponsor})
+			}
+		}
+	}
+	for _, a := range unidentified {
+		bioguideID, err := r.resolve(a.billID, a.chamber, a.sponsor)
+		if err != nil {
+			report.Add(Issue{
+				Stage:  "identity",
+				Record: fmt.Sprintf("%d %s", congress, a.billID),
+				Reason: err.Error(),
+			})
+			continue
+		}
+		addAppearance(bioguideID, a.chamber, a.sponsor.Name)
+	}
+	sharedNames(congress, m, report)
+
+	// histories are derived from every bill of the congress, as a changed bill can move the
+	// boundaries that its member's other bills fall within
+	// members with imported legislator terms keep the history built from those terms
+	all, err := store.GetBills(bson.M{"congress": congress})
+	if err != nil {
+		return err
+	}
+	observed := map[string][]observation{}
+	for _, b := range all {
+		dated := map[database.Sponsor]time.Time{}
+		for _, sponsor := range b.Sponsors {
+			dated[database.Sponsor{Name: sponsor.Name, BioguideID: sponsor.BioguideID}] = b.Introduced
+		}
+		for _, c := range b.Cosponsors {
+			dated[database.Sponsor{Name: c.Name, BioguideID: c.BioguideID}] = c.Date
+		}
+		for sponsor, date := range dated {
+			bioguideID, err := r.resolve(b.ID, b.Chamber(), sponsor)
+			if err != nil {
+				continue
+			}
+			party, err := partyOf(sponsor.Name)
+			if err != nil {
+				continue
+			}
+			observed[bioguideID] = append(observed[bioguideID], observation{date, string(party)})
+		}
+	}
+	changed := map[string]bool{}
+	for bioguideID, member := range m {
+		if len(member.Terms) > 0 {
+			continue
+		}
+		history := deriveHistory(observed[bioguideID])
+		if sameHistory(history, member.PartyHistory) {
+			continue
+		}
+		member.PartyHistory = history
+		changed[bioguideID] = true
+		if !added[bioguideID] {
+			updated[bioguideID] = true
+		}
+	}
+
 	members := []interface{}{}
-	for _, member := range m {
-		members = append(members, member)
+	for _, bioguideID := range utility.Keys(added) {
+		members = append(members, m[bioguideID])
+	}
+	if len(members) > 0 {
+		if err := store.InsertMembers(members); err != nil {
+			return err
+		}
+	}
+	for bioguideID := range updated {
+		member := m[bioguideID]
+		filter := bson.M{"congress": congress, "bioguideId": bioguideID}
+		update := bson.M{
+			"$set": bson.M{
+				"parties":      member.Parties,
+				"districts":    member.Districts,
+				"fullStrings":  member.FullStrings,
+				"partyHistory": member.PartyHistory,
+			},
+		}
+		if err := store.UpdateMember(filter, update); err != nil {
+			report.Add(Issue{
+				Stage:  "members",
+				Record: fmt.Sprintf("%d %s", congress, member.Name),
+				Reason: err.Error(),
+			})
+		}
+	}
+	for bioguideID := range changed {
+		if err := markMemberBills(store, congress, bioguideID); err != nil {
+			return err
+		}
 	}
-	return database.InsertMembers(members)
+	return store.ClearPending(pending, database.StageMembers)
 }
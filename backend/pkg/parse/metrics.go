@@ -0,0 +1,61 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/graph"
+	"backend/pkg/utility"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PopulateMetrics computes the network metrics of every member from the cells of their chamber selected
+// by the edge policy the cells stage was configured with, which must have built those kinds of cell
+// Each chamber is its own network, so the House and Senate are scaled and normalized apart
+// Any touched member recomputes their whole congress, as a change can shift every member's centrality
+func PopulateMetrics(store database.Store, touched Touched, edges string, report *Report) error {
+	kinds, err := database.EdgeKinds(edges)
+	if err != nil {
+		return err
+	}
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return err
+	}
+	for _, congress := range congresses {
+		if touched != nil && len(touched[congress]) == 0 {
+			continue
+		}
+		build, err := store.GetCellBuild(congress)
+		if err != nil {
+			return err
+		}
+		for _, kind := range kinds {
+			if !utility.Contains(build.Kinds, kind) {
+				return fmt.Errorf("%s congress has no %s cells, rebuild them with -edges %s", utility.Ordinal(congress), kind, edges)
+			}
+		}
+		for _, chamber := range []string{database.House, database.Senate} {
+			g, err := graph.Load(store, congress, chamber, edges, database.WeightCount)
+			if err != nil {
+				return err
+			}
+			for bioguideID, metrics := range g.Metrics() {
+				filter := bson.M{"congress": congress, "bioguideId": bioguideID}
+				update := bson.M{
+					"$set": bson.M{
+						"metrics": metrics,
+					},
+				}
+				if err := store.UpdateMember(filter, update); err != nil {
+					report.Add(Issue{
+						Stage:  "metrics",
+						Record: fmt.Sprintf("%d %s", congress, bioguideID),
+						Reason: err.Error(),
+					})
+				}
+			}
+		}
+	}
+	return store.Flush()
+}
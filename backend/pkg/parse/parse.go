@@ -0,0 +1,41 @@
+// Package parse builds the collections from BILLSTATUS files in a pipeline of stages
+// The pipeline is incremental: PopulateBills stores a content hash with each bill, skips files whose hash is
+// already stored, and marks new and changed bills pending for every stage in database.Stages
+// Each of those stages loads a congress's documents into memory, retracts the previous contributions of its
+// pending bills, adds their current ones, writes only the changed documents in a single bulk write and then
+// clears its flag on the bills it processed
+// The member stages downstream of cells recompute only the Touched members
+// Problems with individual files, bills and members are recorded in the Report rather than stopping the run
+package parse
+
+import "backend/internal/database"
+
+// PopulateAll runs every stage of the pipeline in order against the store
+func PopulateAll(store database.Store, dirs []string, overrides *Overrides, legislators, edges string, report *Report) error {
+	if err := PopulateBills(store, dirs, report); err != nil {
+		return err
+	}
+	if err := PopulateMembers(store, overrides, report); err != nil {
+		return err
+	}
+	if err := PopulateLegislators(store, legislators, report); err != nil {
+		return err
+	}
+	touched, err := PopulateCells(store, overrides, edges, report)
+	if err != nil {
+		return err
+	}
+	if err := PopulateCounts(store, touched, report); err != nil {
+		return err
+	}
+	if err := PopulateMetrics(store, touched, edges, report); err != nil {
+		return err
+	}
+	if err := PopulateCommunities(store, touched, report); err != nil {
+		return err
+	}
+	if err := PopulateSubjects(store, report); err != nil {
+		return err
+	}
+	return PopulateSearch(store, report)
+}
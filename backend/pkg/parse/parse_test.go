@@ -0,0 +1,398 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/utility"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fixtures copies the BILLSTATUS fixtures into a temporary directory that a test may edit
+func fixtures(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	paths, err := filepath.Glob(filepath.Join("testdata", "bills", "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(path)), bs, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testOverrides fixes the source's wrong bioguide ID for Cole's middle name and moves Cole's
+// appearance on hr6 to a second member of the same name
+var testOverrides = &Overrides{
+	Merges: []Merge{{Names: []string{"Cole, Calvin [R-OH-3]"}, MemberID: "C000003"}},
+	Splits: []Split{{Congress: 116, Name: "Cole, Cal [R-OH-3]", Bills: []string{"hr6"}, MemberID: "D000007"}},
+}
+
+// populate runs the bill, member and cell stages over dir, building every edge kind
+func populate(t *testing.T, store database.Store, dir string) (*Report, Touched) {
+	t.Helper()
+	report := NewReport()
+	if err := PopulateBills(store, []string{dir}, report); err != nil {
+		t.Fatal(err)
+	}
+	if err := PopulateMembers(store, testOverrides, report); err != nil {
+		t.Fatal(err)
+	}
+	touched, err := PopulateCells(store, testOverrides, database.EdgesAll, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report, touched
+}
+
+// cellBills maps each stored cell, keyed by chamber, position and edge kind, to its sorted bill IDs
+func cellBills(t *testing.T, store database.Store) map[string]string {
+	t.Helper()
+	cells := map[string]string{}
+	err := store.EachCell(bson.M{}, nil, database.Window{}, func(c database.Cell) error {
+		billIDs := []string{}
+		for billID := range c.BillIDs {
+			billIDs = append(billIDs, billID)
+		}
+		sort.Strings(billIDs)
+		if c.Count != len(billIDs) {
+			t.Errorf("%s %s counts %d bills of %v", c.Position, c.Edges, c.Count, billIDs)
+		}
+		cells[c.Chamber+" "+c.Position+" "+c.Edges] = strings.Join(billIDs, ",")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cells
+}
+
+func bill(t *testing.T, store database.Store, id string) database.Bill {
+	t.Helper()
+	bills, err := store.GetBills(bson.M{"congress": 116, "id": id})
+	if err != nil || len(bills) != 1 {
+		t.Fatalf("bill %s: %v %v", id, bills, err)
+	}
+	return bills[0]
+}
+
+func member(t *testing.T, store database.Store, bioguideID string) database.Member {
+	t.Helper()
+	members, _, err := store.GetMembers(bson.M{"congress": 116, "bioguideId": bioguideID})
+	if err != nil || len(members) != 1 {
+		t.Fatalf("member %s: %v %v", bioguideID, members, err)
+	}
+	return members[0]
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
+
+func TestPopulate(t *testing.T) {
+	store := database.NewMemory()
+	populate(t, store, fixtures(t))
+
+	bills, err := store.GetBills(bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, b := range bills {
+		ids = append(ids, b.ID)
+	}
+	sort.Strings(ids)
+	// hr9 has a bad date and broken.xml does not decode
+	if got := strings.Join(ids, ","); got != "hr1,hr2,hr3,hr4,hr5,hr6,hr7,s1" {
+		t.Errorf("bills = %s", got)
+	}
+	hr1 := bill(t, store, "hr1")
+	if hr1.Title != "Clean Energy Act" || hr1.PolicyArea != "Energy" || !hr1.Introduced.Equal(date("2019-01-03")) ||
+		len(hr1.Cosponsors) != 2 || !hr1.Cosponsors[0].Original || hr1.Cosponsors[1].Original ||
+		hr1.Link != "https://www.congress.gov/bill/116th-congress/house-bill/1" {
+		t.Errorf("hr1 = %+v", hr1)
+	}
+	if hr1.Score != -1 || hr1.NumDems != 1 || hr1.NumReps != 2 || !hr1.MultiParty {
+		t.Errorf("hr1 counts = %+v", hr1)
+	}
+
+	want := map[string]string{
+		"house A000001_A000004 cross":  "hr2,hr3",
+		"house A000001_B000002 cross":  "hr1,hr2,hr3",
+		"house A000001_C000003 cross":  "hr1",
+		"house A000001_D000007 cross":  "hr6",
+		"house A000004_B000002 cross":  "hr3",
+		"house A000004_B000002 same":   "hr2",
+		"house B000002_C000003 same":   "hr1,hr4",
+		"senate S000005_T000006 cross": "s1",
+	}
+	if cells := cellBills(t, store); !reflect.DeepEqual(cells, want) {
+		t.Errorf("cells = %v", cells)
+	}
+	build, err := store.GetCellBuild(116)
+	if err != nil || !reflect.DeepEqual(build.Kinds, []string{database.EdgesCross, database.EdgesSame}) || !build.Edges {
+		t.Errorf("cell build = %+v %v", build, err)
+	}
+
+	// the members and cells stages are done with every bill but hr5, whose unknown cosponsor keeps it pending
+	for _, b := range bills {
+		want := []string{database.StageSubjects, database.StageSearch}
+		if b.ID == "hr5" {
+			want = []string{database.StageCells, database.StageSubjects, database.StageSearch}
+		}
+		if !reflect.DeepEqual(b.Pending, want) {
+			t.Errorf("%s pending %v, want %v", b.ID, b.Pending, want)
+		}
+	}
+}
+
+func TestPartyAt(t *testing.T) {
+	store := database.NewMemory()
+	populate(t, store, fixtures(t))
+
+	// Amash cosponsors hr2 as a Republican and sponsors hr3 as an independent
+	amash := member(t, store, "A000004")
+	if !reflect.DeepEqual(amash.Parties, []string{"R", "I"}) || len(amash.PartyHistory) != 2 {
+		t.Fatalf("A000004 = %+v", amash)
+	}
+	first, second := amash.PartyHistory[0], amash.PartyHistory[1]
+	if first.Party != "R" || !first.Start.Equal(date("2019-03-05")) || first.End == nil || !first.End.Equal(date("2019-08-01")) ||
+		second.Party != "I" || !second.Start.Equal(date("2019-08-01")) || second.End != nil {
+		t.Errorf("party history = %+v %+v", first, second)
+	}
+	for _, test := range []struct {
+		date  string
+		party string
+	}{
+		{"2019-01-01", "R"},
+		{"2019-03-05", "R"},
+		{"2019-07-31", "R"},
+		{"2019-08-01", "I"},
+		{"2021-01-01", "I"},
+	} {
+		if party := amash.PartyAt(date(test.date)); party != test.party {
+			t.Errorf("party on %s = %q, want %q", test.date, party, test.party)
+		}
+	}
+	if party := (database.Member{Parties: []string{"D"}}).PartyAt(date("2019-01-01")); party != "D" {
+		t.Errorf("party without history = %q", party)
+	}
+
+	// each appearance carries the party held on its date, and the bill's counts follow
+	if hr2 := bill(t, store, "hr2"); hr2.Cosponsors[1].Party != "R" || hr2.NumReps != 2 || hr2.NumInds != 0 {
+		t.Errorf("hr2 = %+v", hr2)
+	}
+	if hr3 := bill(t, store, "hr3"); hr3.Sponsors[0].Party != "I" || hr3.NumInds != 1 || hr3.NumDems != 1 || hr3.NumReps != 1 {
+		t.Errorf("hr3 = %+v", hr3)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	store := database.NewMemory()
+	dir := fixtures(t)
+	populate(t, store, dir)
+	before := cellBills(t, store)
+
+	// Cole leaves hr1 and Amash, by now an independent, joins it
+	path := filepath.Join(dir, "BILLSTATUS-116hr1.xml")
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xml := strings.Replace(string(bs), "<bioguideId>C000003</bioguideId><fullName>Rep. Cole, Cal [R-OH-3]</fullName><sponsorshipDate>2019-02-01",
+		"<bioguideId>A000004</bioguideId><fullName>Rep. Amash, Justin [I-MI-3]</fullName><sponsorshipDate>2019-09-01", 1)
+	if xml == string(bs) {
+		t.Fatal("hr1 fixture was not changed")
+	}
+	if err := ioutil.WriteFile(path, []byte(xml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, touched := populate(t, store, dir)
+	after := cellBills(t, store)
+	stored := cellBills(t, store)
+
+	want := map[string]string{
+		"house A000001_A000004 cross": "hr1,hr2,hr3",
+		"house A000001_C000003 cross": "",
+		"house A000004_B000002 cross": "hr1,hr3",
+		"house B000002_C000003 same":  "hr4",
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			after[key] = ""
+		}
+	}
+	for key, billIDs := range after {
+		if w, ok := want[key]; ok {
+			if billIDs != w {
+				t.Errorf("%s holds %q, want %q", key, billIDs, w)
+			}
+		} else if billIDs != before[key] {
+			t.Errorf("%s changed from %q to %q", key, before[key], billIDs)
+		}
+	}
+	if got := strings.Join(utility.Keys(touched[116]), ","); got != "A000001,A000004,B000002,C000003" {
+		t.Errorf("touched = %s", got)
+	}
+
+	hr1 := bill(t, store, "hr1")
+	if !reflect.DeepEqual(hr1.Pending, []string{database.StageSubjects, database.StageSearch}) ||
+		hr1.Cosponsors[1].Party != "I" || hr1.NumInds != 1 || hr1.NumReps != 1 {
+		t.Errorf("hr1 = %+v", hr1)
+	}
+	if hr5 := bill(t, store, "hr5"); !utility.Contains(hr5.Pending, database.StageCells) {
+		t.Errorf("hr5 pending %v", hr5.Pending)
+	}
+
+	// a third run finds nothing to do
+	report, touched := populate(t, store, dir)
+	if len(touched[116]) != 0 || !reflect.DeepEqual(cellBills(t, store), stored) {
+		t.Errorf("unchanged run touched %v", touched)
+	}
+	if summary := report.Summary(); summary["members"] != 0 || summary["identity"] != 0 {
+		t.Errorf("unchanged run reported %v", summary)
+	}
+}
+
+func TestReport(t *testing.T) {
+	store := database.NewMemory()
+	report, _ := populate(t, store, fixtures(t))
+
+	found := map[string]string{}
+	for _, issue := range report.Issues {
+		key := issue.Stage + " " + issue.Record
+		if issue.Path != "" {
+			key = issue.Stage + " " + filepath.Base(issue.Path) + " " + issue.Element
+		}
+		found[key] = issue.Reason
+	}
+	for key, reason := range map[string]string{
+		"bills broken.xml ":                          "EOF",
+		"bills BILLSTATUS-116hr9.xml introducedDate": "month out of range",
+		"bills BILLSTATUS-116hr7.xml surprise":       "unexpected element under bill",
+		"identity 116 hr5":                           "matches no known member",
+		"identity 116 Cole, Cal":                     "C000003, D000007",
+		"cells 116 hr5":                              "matches no known member",
+	} {
+		if !strings.Contains(found[key], reason) {
+			t.Errorf("%s reported %q, want %q", key, found[key], reason)
+		}
+	}
+	if len(found) != 6 {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+	if summary := report.Summary(); summary["bills"] != 3 || summary["identity"] != 2 || summary["cells"] != 1 {
+		t.Errorf("summary = %v", summary)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.WriteJSON(path); err != nil {
+		t.Fatal(err)
+	}
+	if bs, err := ioutil.ReadFile(path); err != nil || !strings.Contains(string(bs), `"stage": "identity"`) {
+		t.Errorf("report file = %s %v", bs, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	store := database.NewMemory()
+	populate(t, store, fixtures(t))
+	report := NewReport()
+	if err := PopulateMetrics(store, nil, database.EdgesCross, report); err != nil {
+		t.Fatal(err)
+	}
+	members, _, err := store.GetMembers(bson.M{"congress": 116})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each chamber is scaled and normalized on its own, so the lone Senate pair scores as the House's leaders do
+	eigenvector := map[string]float64{}
+	pageRank := map[string]float64{}
+	for _, m := range members {
+		if m.Metrics == nil {
+			t.Fatalf("%s has no metrics", m.BioguideID)
+		}
+		eigenvector[m.Chamber] = math.Max(eigenvector[m.Chamber], m.Metrics.Eigenvector)
+		pageRank[m.Chamber] += m.Metrics.PageRank
+	}
+	for _, chamber := range []string{database.House, database.Senate} {
+		if math.Abs(eigenvector[chamber]-1) > 1e-9 || math.Abs(pageRank[chamber]-1) > 1e-9 {
+			t.Errorf("%s eigenvector max %v, pagerank sum %v", chamber, eigenvector[chamber], pageRank[chamber])
+		}
+	}
+	if adams := member(t, store, "A000001"); adams.Metrics.Degree != 4 {
+		t.Errorf("A000001 metrics = %+v", adams.Metrics)
+	}
+
+	// once only same-party cells are built there are no cross-party ones to compute from
+	if _, err := PopulateCells(store, testOverrides, database.EdgesSame, report); err != nil {
+		t.Fatal(err)
+	}
+	if err := PopulateMetrics(store, nil, database.EdgesCross, report); err == nil || !strings.Contains(err.Error(), "no cross cells") {
+		t.Errorf("metrics over missing cells returned %v", err)
+	}
+	if err := PopulateMetrics(store, nil, database.EdgesSame, report); err != nil {
+		t.Errorf("metrics over same-party cells returned %v", err)
+	}
+}
+
+func TestCommunities(t *testing.T) {
+	store := database.NewMemory()
+	populate(t, store, fixtures(t))
+	if err := PopulateCommunities(store, nil, NewReport()); err != nil {
+		t.Fatal(err)
+	}
+	// the Senate pair forms its own community, numbered on from the House's
+	house := 0
+	for _, bioguideID := range []string{"A000001", "A000004", "B000002", "C000003", "D000007"} {
+		m := member(t, store, bioguideID)
+		if m.Community < 1 {
+			t.Errorf("%s is in community %d", bioguideID, m.Community)
+		}
+		if m.Community > house {
+			house = m.Community
+		}
+	}
+	for _, bioguideID := range []string{"S000005", "T000006"} {
+		if m := member(t, store, bioguideID); m.Community != house+1 {
+			t.Errorf("%s is in community %d after %d house communities", bioguideID, m.Community, house)
+		}
+	}
+
+	communities, err := store.GetCommunities(116, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(communities) != house+1 {
+		t.Fatalf("communities = %+v", communities)
+	}
+	for i, c := range communities {
+		chamber := database.House
+		if i == house {
+			chamber = database.Senate
+		}
+		if c.Community != i+1 || c.Chamber != chamber {
+			t.Errorf("community %d = %+v", i+1, c)
+		}
+		for _, bioguideID := range c.Members {
+			if m := member(t, store, bioguideID); m.Chamber != c.Chamber {
+				t.Errorf("community %d mixes %s into the %s", c.Community, bioguideID, c.Chamber)
+			}
+		}
+	}
+}
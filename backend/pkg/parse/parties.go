@@ -0,0 +1,87 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// observation is a member's party as shown on a dated appearance
+type observation struct {
+	date  time.Time
+	party string
+}
+
+// deriveHistory builds party intervals from the dated appearances of a member,
+// opening a new interval whenever the party shown changes
+func deriveHistory(observations []observation) []database.PartyInterval {
+	sort.Slice(observations, func(i, j int) bool {
+		return observations[i].date.Before(observations[j].date)
+	})
+	history := []database.PartyInterval{}
+	for _, o := range observations {
+		n := len(history)
+		if n > 0 && history[n-1].Party == o.party {
+			continue
+		}
+		if n > 0 {
+			end := o.date
+			history[n-1].End = &end
+		}
+		history = append(history, database.PartyInterval{Party: o.party, Start: o.date})
+	}
+	return history
+}
+
+// appendInterval adds an interval to a history, extending the last interval when the party is unchanged
+func appendInterval(history []database.PartyInterval, interval database.PartyInterval) []database.PartyInterval {
+	n := len(history)
+	if n > 0 && history[n-1].Party == interval.Party {
+		history[n-1].End = interval.End
+		return history
+	}
+	return append(history, interval)
+}
+
+// partyLetter abbreviates a party name (e.g. Democrat) to the letter used in BILLSTATUS
+func partyLetter(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(name[:1])
+}
+
+// sameHistory reports whether two party histories hold the same intervals
+func sameHistory(a, b []database.PartyInterval) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Party != b[i].Party || !a[i].Start.Equal(b[i].Start) {
+			return false
+		}
+		if (a[i].End == nil) != (b[i].End == nil) || (a[i].End != nil && !a[i].End.Equal(*b[i].End)) {
+			return false
+		}
+	}
+	return true
+}
+
+// markMemberBills queues the bills a member appears on for the cells stage,
+// which recomputes each appearance's party from the member's history
+// A zero congress marks the member's bills in every congress
+func markMemberBills(store database.Store, congress int, bioguideID string) error {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"sponsors.bioguideId": bioguideID},
+			{"cosponsors.bioguideId": bioguideID},
+		},
+	}
+	if congress != 0 {
+		filter["congress"] = congress
+	}
+	return store.MarkPending(filter, database.StageCells)
+}
@@ -0,0 +1,98 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Issue describes a single file or record the pipeline could not process
+type Issue struct {
+	Stage   string `json:"stage"`
+	Path    string `json:"path,omitempty"`
+	Element string `json:"element,omitempty"`
+	Record  string `json:"record,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Report collects issues from every stage so a bad record never halts a run
+// It is safe for concurrent use by the stage goroutines
+type Report struct {
+	mu     sync.Mutex
+	Issues []Issue `json:"issues"`
+}
+
+// NewReport constructs an empty report
+func NewReport() *Report {
+	return &Report{Issues: []Issue{}}
+}
+
+// Add records an issue
+func (r *Report) Add(issue Issue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Issues = append(r.Issues, issue)
+}
+
+// Addf records an issue with a formatted reason
+func (r *Report) Addf(stage, path, element, format string, args ...interface{}) {
+	r.Add(Issue{
+		Stage:   stage,
+		Path:    path,
+		Element: element,
+		Reason:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Summary returns the number of issues per stage
+func (r *Report) Summary() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := map[string]int{}
+	for _, issue := range r.Issues {
+		counts[issue.Stage]++
+	}
+	return counts
+}
+
+// PrintSummary prints the number of issues per stage
+func (r *Report) PrintSummary() {
+	counts := r.Summary()
+	if len(counts) == 0 {
+		fmt.Println("No parse errors")
+		return
+	}
+	stages := []string{}
+	for stage := range counts {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	fmt.Println("Parse errors by stage:")
+	for _, stage := range stages {
+		fmt.Printf("  %s: %d\n", stage, counts[stage])
+	}
+}
+
+// PrintIssues prints every issue recorded by a stage
+func (r *Report) PrintIssues(stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, issue := range r.Issues {
+		if issue.Stage == stage {
+			fmt.Printf("  %s: %s\n", issue.Record, issue.Reason)
+		}
+	}
+}
+
+// WriteJSON writes the report to path as JSON
+func (r *Report) WriteJSON(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bs, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
@@ -0,0 +1,153 @@
+package parse
+
+import (
+	"backend/internal/database"
+	"backend/pkg/search"
+	"backend/pkg/utility"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PopulateSearch maintains the inverted index of bill titles, summaries and subjects and each congress's search statistics
+func PopulateSearch(store database.Store, report *Report) error {
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return err
+	}
+	for _, congress := range congresses {
+		if err := populateCongressSearch(store, congress, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type postingKey struct {
+	billID string
+	field  string
+}
+
+// invertedIndex maps each term of a congress to its postings
+type invertedIndex struct {
+	postings map[string]map[postingKey]database.Posting
+	changed  map[string]bool
+}
+
+func newInvertedIndex(terms []database.SearchTerm) *invertedIndex {
+	idx := &invertedIndex{postings: map[string]map[postingKey]database.Posting{}, changed: map[string]bool{}}
+	for _, t := range terms {
+		idx.postings[t.Term] = map[postingKey]database.Posting{}
+		for _, p := range t.Postings {
+			idx.postings[t.Term][postingKey{p.BillID, p.Field}] = p
+		}
+	}
+	return idx
+}
+
+// remove drops the postings of the supplied bills from every term
+func (idx *invertedIndex) remove(billIDs map[string]bool) {
+	for term, postings := range idx.postings {
+		for key := range postings {
+			if billIDs[key.billID] {
+				delete(postings, key)
+				idx.changed[term] = true
+			}
+		}
+	}
+}
+
+func (idx *invertedIndex) add(b database.Bill) {
+	for field, tokens := range search.Document(b) {
+		for _, t := range tokens {
+			if idx.postings[t.Term] == nil {
+				idx.postings[t.Term] = map[postingKey]database.Posting{}
+			}
+			key := postingKey{b.ID, field}
+			p, ok := idx.postings[t.Term][key]
+			if !ok {
+				p = database.Posting{BillID: b.ID, Field: field, Length: len(tokens)}
+			}
+			p.Positions = append(p.Positions, t.Position)
+			idx.postings[t.Term][key] = p
+			idx.changed[t.Term] = true
+		}
+	}
+}
+
+// stats counts the indexed bills and the total length of each field
+func (idx *invertedIndex) stats(congress int) database.SearchStats {
+	lengths := map[postingKey]int{}
+	for _, postings := range idx.postings {
+		for key, p := range postings {
+			lengths[key] = p.Length
+		}
+	}
+	stats := database.SearchStats{Congress: congress, Lengths: map[string]int{}}
+	bills := map[string]bool{}
+	for key, length := range lengths {
+		bills[key.billID] = true
+		stats.Lengths[key.field] += length
+	}
+	stats.Bills = len(bills)
+	return stats
+}
+
+func populateCongressSearch(store database.Store, congress int, report *Report) error {
+	pending := bson.M{"congress": congress, "pending": database.StageSearch}
+	bills, err := store.GetBills(pending)
+	if err != nil {
+		return err
+	}
+	if len(bills) == 0 {
+		return nil
+	}
+	start := time.Now()
+
+	stored, err := store.GetTerms(bson.M{"congress": congress})
+	if err != nil {
+		return err
+	}
+	idx := newInvertedIndex(stored)
+	billIDs := map[string]bool{}
+	for _, b := range bills {
+		billIDs[b.ID] = true
+	}
+	idx.remove(billIDs)
+	for _, b := range bills {
+		idx.add(b)
+	}
+
+	terms := []database.SearchTerm{}
+	for _, term := range utility.Keys(idx.changed) {
+		t := database.SearchTerm{Congress: congress, Term: term, Postings: []database.Posting{}}
+		for _, p := range idx.postings[term] {
+			t.Postings = append(t.Postings, p)
+		}
+		sort.Slice(t.Postings, func(i, j int) bool {
+			if t.Postings[i].BillID != t.Postings[j].BillID {
+				return t.Postings[i].BillID < t.Postings[j].BillID
+			}
+			return t.Postings[i].Field < t.Postings[j].Field
+		})
+		terms = append(terms, t)
+	}
+	if err := store.ReplaceTerms(terms); err != nil {
+		report.Add(Issue{
+			Stage:  "search",
+			Record: fmt.Sprintf("%d terms", congress),
+			Reason: err.Error(),
+		})
+		return nil
+	}
+	if err := store.ReplaceSearchStats(idx.stats(congress)); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("%s congress: %d bills indexed, %d terms written in %s (%.0f documents/s)\n",
+		utility.Ordinal(congress), len(bills), len(terms), elapsed.Round(time.Millisecond), float64(len(terms))/elapsed.Seconds())
+
+	return store.ClearPending(pending, database.StageSearch)
+}
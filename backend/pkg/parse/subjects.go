@@ -2,145 +2,146 @@ package parse
 
 import (
 	"backend/internal/database"
+	"backend/pkg/utility"
 	"fmt"
-	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-func appendPolicyArea(policyArea database.PolicyArea, cells []database.Cell, throttle chan struct{}, wg *sync.WaitGroup) {
-	defer func() {
-		throttle <- struct{}{}
-		wg.Done()
-	}()
-	for _, cell := range cells {
-		for _, billNumber := range policyArea.BillNumbers {
-			if _, ok := cell.BillNumbers[billNumber]; ok {
-				filter := bson.M{"position": cell.Position}
-				update := bson.M{
-					"$push": bson.M{
-						"policyAreas": policyArea.PolicyArea,
-					},
-				}
-				err := database.UpsertCell(filter, update)
-				if err != nil {
-					panic(err.Error())
-				}
-				// one match is sufficient
-				break
-			}
+// PopulateSubjects populates the policy areas and subjects collection from information in bills collection
+// Cell policy areas and subjects are maintained by PopulateCells
+func PopulateSubjects(store database.Store, report *Report) error {
+	congresses, err := store.GetCongresses()
+	if err != nil {
+		return err
+	}
+	for _, congress := range congresses {
+		if err := populateCongressSubjects(store, congress, report); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// categories maps each policy area or subject of a congress to the set of its bills
+type categories struct {
+	bills   map[string]map[string]bool
+	changed map[string]bool
+}
+
+func newCategories() *categories {
+	return &categories{bills: map[string]map[string]bool{}, changed: map[string]bool{}}
 }
 
-func appendSubject(subject database.Subject, cells []database.Cell, throttle chan struct{}, wg *sync.WaitGroup) {
-	defer func() {
-		throttle <- struct{}{}
-		wg.Done()
-	}()
-	for _, cell := range cells {
-		for _, billNumber := range subject.BillNumbers {
-			if _, ok := cell.BillNumbers[billNumber]; ok {
-				filter := bson.M{"position": cell.Position}
-				update := bson.M{
-					"$push": bson.M{
-						"subjects": subject.Subject,
-					},
-				}
-				err := database.UpsertCell(filter, update)
-				if err != nil {
-					panic(err.Error())
-				}
-				// one match is sufficient
-				break
+func (c *categories) load(name string, billIDs []string) {
+	c.bills[name] = map[string]bool{}
+	for _, billID := range billIDs {
+		c.bills[name][billID] = true
+	}
+}
+
+// remove drops the supplied bills from every category
+func (c *categories) remove(billIDs map[string]bool) {
+	for name, bills := range c.bills {
+		for billID := range bills {
+			if billIDs[billID] {
+				delete(bills, billID)
+				c.changed[name] = true
 			}
 		}
 	}
 }
 
-// iterate over all subjects and policy areas
-// iterate over all cells
-// iterate over all bill numbers belonging to the subject or policy area
-// if a bill number for this subject / policy area appears in the cell's bill number set append this subject / policy area
-func updateCellSubjects() error {
-	subjects, err := database.GetSubjects(bson.M{})
-	if err != nil {
-		return err
+func (c *categories) add(name, billID string) {
+	if name == "" {
+		return
 	}
-	policyAreas, err := database.GetPolicyAreas()
+	if c.bills[name] == nil {
+		c.bills[name] = map[string]bool{}
+	}
+	c.bills[name][billID] = true
+	c.changed[name] = true
+}
+
+func populateCongressSubjects(store database.Store, congress int, report *Report) error {
+	pending := bson.M{"congress": congress, "pending": database.StageSubjects}
+	bills, err := store.GetBills(pending)
 	if err != nil {
 		return err
 	}
-	cells, err := database.GetCells(bson.M{}, nil)
+	if len(bills) == 0 {
+		return nil
+	}
+	start := time.Now()
+
+	filter := bson.M{"congress": congress}
+	storedPolicyAreas, err := store.GetPolicyAreas(filter)
 	if err != nil {
 		return err
 	}
-	fmt.Println("Updating cell policy areas...")
-	throttle := make(chan struct{}, 16)
-	for i := 0; i < 16; i++ {
-		throttle <- struct{}{}
-	}
-	wg := sync.WaitGroup{}
-	for _, policyArea := range policyAreas {
-		<-throttle
-		wg.Add(1)
-		go appendPolicyArea(policyArea, cells, throttle, &wg)
-	}
-	wg.Wait()
-	fmt.Println("Updating cell subjects...")
-	for _, subject := range subjects {
-		<-throttle
-		wg.Add(1)
-		go appendSubject(subject, cells, throttle, &wg)
-	}
-	wg.Wait()
-	return nil
-}
-
-// PopulateSubjects populates the policy areas and subjects collection from information in bills collection
-func PopulateSubjects() error {
-	bills, err := database.GetBills(bson.M{})
+	storedSubjects, err := store.GetSubjects(filter)
 	if err != nil {
 		return err
 	}
+	policyAreas := newCategories()
+	for _, p := range storedPolicyAreas {
+		policyAreas.load(p.PolicyArea, p.BillIDs)
+	}
+	subjects := newCategories()
+	for _, s := range storedSubjects {
+		subjects.load(s.Subject, s.BillIDs)
+	}
 
-	policyAreaMap := map[string][]int{}
-	subjectMap := map[string][]int{}
-
+	billIDs := map[string]bool{}
 	for _, b := range bills {
-		if b.PolicyArea == "" {
-			continue
-		}
-		if billNumbers, ok := policyAreaMap[b.PolicyArea]; !ok {
-			policyAreaMap[b.PolicyArea] = []int{b.Number}
-		} else {
-			policyAreaMap[b.PolicyArea] = append(billNumbers, b.Number)
-		}
+		billIDs[b.ID] = true
+	}
+	policyAreas.remove(billIDs)
+	subjects.remove(billIDs)
+	for _, b := range bills {
+		policyAreas.add(b.PolicyArea, b.ID)
 		for _, subject := range b.Subjects {
-			if subject == "" {
-				continue
-			}
-			if billNumbers, ok := subjectMap[subject]; !ok {
-				subjectMap[subject] = []int{b.Number}
-			} else {
-				subjectMap[subject] = append(billNumbers, b.Number)
-			}
+			subjects.add(subject, b.ID)
 		}
 	}
 
-	for policyArea, billNumbers := range policyAreaMap {
-		err := database.InsertPolicyArea(policyArea, billNumbers)
-		if err != nil {
-			return err
-		}
+	policyAreaDocs := []database.PolicyArea{}
+	for _, name := range utility.Keys(policyAreas.changed) {
+		policyAreaDocs = append(policyAreaDocs, database.PolicyArea{
+			Congress:   congress,
+			PolicyArea: name,
+			BillIDs:    utility.Keys(policyAreas.bills[name]),
+		})
 	}
-
-	for subject, billNumbers := range subjectMap {
-		err := database.InsertSubject(subject, billNumbers)
-		if err != nil {
-			return err
-		}
+	subjectDocs := []database.Subject{}
+	for _, name := range utility.Keys(subjects.changed) {
+		subjectDocs = append(subjectDocs, database.Subject{
+			Congress: congress,
+			Subject:  name,
+			BillIDs:  utility.Keys(subjects.bills[name]),
+		})
+	}
+	if err := store.ReplacePolicyAreas(policyAreaDocs); err != nil {
+		report.Add(Issue{
+			Stage:  "subjects",
+			Record: fmt.Sprintf("%d policy areas", congress),
+			Reason: err.Error(),
+		})
+		return nil
+	}
+	if err := store.ReplaceSubjects(subjectDocs); err != nil {
+		report.Add(Issue{
+			Stage:  "subjects",
+			Record: fmt.Sprintf("%d subjects", congress),
+			Reason: err.Error(),
+		})
+		return nil
 	}
+	elapsed := time.Since(start)
+	written := len(policyAreaDocs) + len(subjectDocs)
+	fmt.Printf("%s congress: %d bills, %d policy areas and subjects written in %s (%.0f documents/s)\n",
+		utility.Ordinal(congress), len(bills), written, elapsed.Round(time.Millisecond), float64(written)/elapsed.Seconds())
 
-	return updateCellSubjects()
+	return store.ClearPending(pending, database.StageSubjects)
 }
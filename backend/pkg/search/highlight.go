@@ -0,0 +1,106 @@
+package search
+
+import (
+	"backend/internal/database"
+	"html"
+	"strings"
+)
+
+// snippetWords is the number of words of summary shown around its matches
+const snippetWords = 30
+
+// Highlights holds the parts of a bill matching a query, HTML escaped with matched words wrapped in <mark>
+// Title is the whole title, Summary a window of the summary with the most matches and Subjects the matching subjects
+type Highlights struct {
+	Title    string   `json:"title,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Subjects []string `json:"subjects,omitempty"`
+}
+
+// Highlight marks the words of a bill matching the query
+func Highlight(b database.Bill, q Query) Highlights {
+	terms := q.matched()
+	h := Highlights{}
+	if tokens := matching(Tokenize(b.Title), terms); len(tokens) > 0 {
+		h.Title = mark(b.Title, tokens, 0, len(b.Title))
+	}
+	for _, subject := range b.Subjects {
+		if tokens := matching(Tokenize(subject), terms); len(tokens) > 0 {
+			h.Subjects = append(h.Subjects, mark(subject, tokens, 0, len(subject)))
+		}
+	}
+	all := Tokenize(b.Summary)
+	tokens := matching(all, terms)
+	if len(tokens) == 0 {
+		return h
+	}
+	// slide a window of snippetWords positions over the matches, keeping the densest
+	best, count := 0, 0
+	for i := range tokens {
+		n := 0
+		for j := i; j < len(tokens) && tokens[j].Position < tokens[i].Position+snippetWords; j++ {
+			n++
+		}
+		if n > count {
+			best, count = i, n
+		}
+	}
+	first := tokens[best].Position - snippetWords/4
+	start, end := 0, len(b.Summary)
+	for _, t := range all {
+		if t.Position < first {
+			start = t.End
+		}
+		if t.Position >= first+snippetWords {
+			end = t.Start
+			break
+		}
+	}
+	start = wordStart(b.Summary, start)
+	snippet := mark(b.Summary, tokens, start, end)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(b.Summary) {
+		snippet += "…"
+	}
+	h.Summary = snippet
+	return h
+}
+
+// matching returns the tokens whose terms are in the supplied set
+func matching(tokens []Token, terms map[string]bool) []Token {
+	matched := []Token{}
+	for _, t := range tokens {
+		if terms[t.Term] {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// wordStart advances i past the separators of text
+func wordStart(text string, i int) int {
+	for i < len(text) && strings.ContainsRune(" \t\n,.;:", rune(text[i])) {
+		i++
+	}
+	return i
+}
+
+// mark escapes text[start:end], wrapping the supplied tokens that fall inside it in <mark>
+func mark(text string, tokens []Token, start, end int) string {
+	var sb strings.Builder
+	at := start
+	for _, t := range tokens {
+		if t.Start < start || t.End > end {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[at:t.Start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[t.Start:t.End]))
+		sb.WriteString("</mark>")
+		at = t.End
+	}
+	sb.WriteString(html.EscapeString(strings.TrimRight(text[at:end], " \t\n")))
+	return sb.String()
+}
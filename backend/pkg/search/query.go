@@ -0,0 +1,94 @@
+package search
+
+import (
+	"errors"
+	"strings"
+)
+
+// Query is a parsed search
+// A bill matches when it contains every phrase and any term, and none of the excluded terms
+// Phrases hold the stemmed words of each quoted phrase with their offsets from its first word
+type Query struct {
+	Terms    []string
+	Phrases  []Phrase
+	Excluded []string
+}
+
+// Phrase is a quoted sequence of stemmed words
+// Offsets give each word's position relative to the first, counting dropped stopwords
+type Phrase struct {
+	Terms   []string
+	Offsets []int
+}
+
+// Parse reads a search string of words, "quoted phrases" and -excluded words
+// An unterminated quote runs to the end of the string
+func Parse(s string) (Query, error) {
+	q := Query{}
+	seen := map[string]bool{}
+	addTerms := func(tokens []Token, excluded bool) {
+		for _, t := range tokens {
+			if excluded {
+				q.Excluded = append(q.Excluded, t.Term)
+				continue
+			}
+			if !seen[t.Term] {
+				seen[t.Term] = true
+				q.Terms = append(q.Terms, t.Term)
+			}
+		}
+	}
+	for s != "" {
+		s = strings.TrimLeft(s, " \t\n")
+		switch {
+		case s == "":
+		case s[0] == '"':
+			end := strings.IndexByte(s[1:], '"')
+			text := s[1:]
+			if end < 0 {
+				s = ""
+			} else {
+				text, s = s[1:end+1], s[end+2:]
+			}
+			tokens := Tokenize(text)
+			if len(tokens) == 0 {
+				continue
+			}
+			phrase := Phrase{}
+			for _, t := range tokens {
+				phrase.Terms = append(phrase.Terms, t.Term)
+				phrase.Offsets = append(phrase.Offsets, t.Position-tokens[0].Position)
+			}
+			q.Phrases = append(q.Phrases, phrase)
+			addTerms(tokens, false)
+		default:
+			end := strings.IndexAny(s, " \t\n\"")
+			word := s
+			if end < 0 {
+				s = ""
+			} else {
+				word, s = s[:end], s[end:]
+			}
+			excluded := strings.HasPrefix(word, "-")
+			addTerms(Tokenize(strings.TrimPrefix(word, "-")), excluded)
+		}
+	}
+	if len(q.Terms) == 0 {
+		return q, errors.New("the search has no words to match")
+	}
+	return q, nil
+}
+
+// matched returns the set of terms that highlight a bill's text
+func (q Query) matched() map[string]bool {
+	terms := map[string]bool{}
+	for _, t := range q.Terms {
+		terms[t] = true
+	}
+	return terms
+}
+
+// lookups returns every term whose postings are needed to evaluate the query
+func (q Query) lookups() []string {
+	return append(append([]string{}, q.Terms...), q.Excluded...)
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		search string
+		want   Query
+	}{
+		{"energy", Query{Terms: []string{"energi"}}},
+		{"Water waters the WATER", Query{Terms: []string{"water"}}},
+		{`energy "clean water" -coal`, Query{
+			Terms:    []string{"energi", "clean", "water"},
+			Phrases:  []Phrase{{Terms: []string{"clean", "water"}, Offsets: []int{0, 1}}},
+			Excluded: []string{"coal"},
+		}},
+		// stopwords inside a phrase keep their place
+		{`"water of the nation"`, Query{
+			Terms:   []string{"water", "nation"},
+			Phrases: []Phrase{{Terms: []string{"water", "nation"}, Offsets: []int{0, 3}}},
+		}},
+		{`"the clean`, Query{
+			Terms:   []string{"clean"},
+			Phrases: []Phrase{{Terms: []string{"clean"}, Offsets: []int{0}}},
+		}},
+		{`air"water"`, Query{
+			Terms:   []string{"air", "water"},
+			Phrases: []Phrase{{Terms: []string{"water"}, Offsets: []int{0}}},
+		}},
+		{`"" tax -a`, Query{Terms: []string{"tax"}}},
+	} {
+		got, err := Parse(test.search)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.search, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.search, got, test.want)
+		}
+	}
+	for _, search := range []string{"", "  ", "the of", "-coal", `"the"`} {
+		if _, err := Parse(search); err == nil {
+			t.Errorf("Parse(%q) did not fail", search)
+		}
+	}
+}
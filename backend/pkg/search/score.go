@@ -0,0 +1,193 @@
+package search
+
+import (
+	"backend/internal/database"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fieldWeights scales each field's contribution to a bill's score
+var fieldWeights = map[string]float64{
+	database.FieldTitle:    3,
+	database.FieldSubjects: 2,
+	database.FieldSummary:  1,
+}
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Hit is a bill matching a query and its relevance score
+type Hit struct {
+	Congress int
+	BillID   string
+	Score    float64
+}
+
+// postings maps each bill of a congress to the postings of one term, keyed by field
+type postings map[string]map[string]database.Posting
+
+// Search returns the bills of the supplied congresses matching the query, highest score first
+// Scores sum each term's BM25 weight over the fields it occurs in, so they are only comparable
+// within a single search
+func Search(store database.Store, q Query, congresses []int) ([]Hit, error) {
+	hits := []Hit{}
+	for _, congress := range congresses {
+		stats, err := store.GetSearchStats(congress)
+		if err != nil {
+			return nil, err
+		}
+		if stats.Bills == 0 {
+			continue
+		}
+		terms, err := store.GetTerms(bson.M{"congress": congress, "term": bson.M{"$in": q.lookups()}})
+		if err != nil {
+			return nil, err
+		}
+		index := map[string]postings{}
+		for _, t := range terms {
+			index[t.Term] = postings{}
+			for _, p := range t.Postings {
+				if index[t.Term][p.BillID] == nil {
+					index[t.Term][p.BillID] = map[string]database.Posting{}
+				}
+				index[t.Term][p.BillID][p.Field] = p
+			}
+		}
+		for billID, score := range scoreCongress(q, index, stats) {
+			hits = append(hits, Hit{Congress: congress, BillID: billID, Score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Congress != hits[j].Congress {
+			return hits[i].Congress < hits[j].Congress
+		}
+		return hits[i].BillID < hits[j].BillID
+	})
+	return hits, nil
+}
+
+// scoreCongress scores the bills of one congress matching the query
+func scoreCongress(q Query, index map[string]postings, stats database.SearchStats) map[string]float64 {
+	candidates := map[string]bool{}
+	if len(q.Phrases) > 0 {
+		for i, phrase := range q.Phrases {
+			matches := phraseMatches(phrase, index)
+			if i == 0 {
+				candidates = matches
+				continue
+			}
+			for billID := range candidates {
+				if !matches[billID] {
+					delete(candidates, billID)
+				}
+			}
+		}
+	} else {
+		for _, term := range q.Terms {
+			for billID := range index[term] {
+				candidates[billID] = true
+			}
+		}
+	}
+	for _, term := range q.Excluded {
+		for billID := range index[term] {
+			delete(candidates, billID)
+		}
+	}
+
+	n := float64(stats.Bills)
+	scores := map[string]float64{}
+	for billID := range candidates {
+		score := 0.0
+		for _, term := range q.Terms {
+			fields := index[term][billID]
+			if len(fields) == 0 {
+				continue
+			}
+			df := float64(len(index[term]))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for field, p := range fields {
+				average := float64(stats.Lengths[field]) / n
+				if average == 0 {
+					average = 1
+				}
+				tf := float64(len(p.Positions))
+				score += fieldWeights[field] * idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(p.Length)/average))
+			}
+		}
+		scores[billID] = score
+	}
+	return scores
+}
+
+// phraseMatches returns the set of bills with a field containing the phrase's words at their offsets
+func phraseMatches(phrase Phrase, index map[string]postings) map[string]bool {
+	matches := map[string]bool{}
+	first := phrase.Terms[0]
+	for billID, fields := range index[first] {
+		for field, p := range fields {
+			if phraseIn(phrase, index, billID, field, p.Positions) {
+				matches[billID] = true
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// phraseIn reports whether the phrase starts at one of the supplied positions of a bill's field
+func phraseIn(phrase Phrase, index map[string]postings, billID, field string, starts []int) bool {
+	positions := make([]map[int]bool, len(phrase.Terms))
+	for i, term := range phrase.Terms {
+		p, ok := index[term][billID][field]
+		if !ok {
+			return false
+		}
+		positions[i] = map[int]bool{}
+		for _, position := range p.Positions {
+			positions[i][position] = true
+		}
+	}
+	for _, start := range starts {
+		found := true
+		for i := range phrase.Terms {
+			if !positions[i][start+phrase.Offsets[i]] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter matches the bills of the supplied hits
+func Filter(hits []Hit) bson.M {
+	ids := map[int][]string{}
+	for _, h := range hits {
+		ids[h.Congress] = append(ids[h.Congress], h.BillID)
+	}
+	congresses := []int{}
+	for congress := range ids {
+		congresses = append(congresses, congress)
+	}
+	sort.Ints(congresses)
+	clauses := []bson.M{}
+	for _, congress := range congresses {
+		clauses = append(clauses, bson.M{"congress": congress, "id": bson.M{"$in": ids[congress]}})
+	}
+	if len(clauses) == 0 {
+		return bson.M{"congress": bson.M{"$in": []int{}}}
+	}
+	return bson.M{"$or": clauses}
+}
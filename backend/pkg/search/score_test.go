@@ -0,0 +1,207 @@
+package search
+
+import (
+	"backend/internal/database"
+	"math"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// index stores the search terms and stats of a congress's bills as the parse stage does
+func index(t *testing.T, store database.Store, congress int, bills ...database.Bill) {
+	t.Helper()
+	terms := map[string]*database.SearchTerm{}
+	order := []string{}
+	stats := database.SearchStats{Congress: congress, Bills: len(bills), Lengths: map[string]int{}}
+	for _, b := range bills {
+		for field, tokens := range Document(b) {
+			stats.Lengths[field] += len(tokens)
+			postings := map[string]int{}
+			for _, token := range tokens {
+				term, ok := terms[token.Term]
+				if !ok {
+					term = &database.SearchTerm{Congress: congress, Term: token.Term}
+					terms[token.Term] = term
+					order = append(order, token.Term)
+				}
+				i, ok := postings[token.Term]
+				if !ok {
+					i = len(term.Postings)
+					postings[token.Term] = i
+					term.Postings = append(term.Postings, database.Posting{BillID: b.ID, Field: field, Length: len(tokens)})
+				}
+				term.Postings[i].Positions = append(term.Postings[i].Positions, token.Position)
+			}
+		}
+	}
+	list := []database.SearchTerm{}
+	for _, term := range order {
+		list = append(list, *terms[term])
+	}
+	if err := store.ReplaceTerms(list); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ReplaceSearchStats(stats); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func search(t *testing.T, store database.Store, s string, congresses ...int) []Hit {
+	t.Helper()
+	q, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := Search(store, q, congresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hits
+}
+
+func hitIDs(hits []Hit) []string {
+	ids := []string{}
+	for _, h := range hits {
+		ids = append(ids, h.BillID)
+	}
+	return ids
+}
+
+// bm25 is one title occurrence's contribution: the field weight times idf times the saturated term frequency
+func bm25(n, df, tf, length, average float64) float64 {
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	return fieldWeights[database.FieldTitle] * idf * tf * (k1 + 1) / (tf + k1*(1-b+b*length/average))
+}
+
+func TestBM25(t *testing.T) {
+	store := database.NewMemory()
+	// title lengths 3, 3 and 2 average 8/3 words
+	index(t, store, 116,
+		database.Bill{ID: "hr1", Title: "Clean water act"},
+		database.Bill{ID: "hr2", Title: "Water, water everywhere"},
+		database.Bill{ID: "hr3", Title: "Energy act"},
+	)
+	average := 8.0 / 3
+
+	hits := search(t, store, "water", 116)
+	if !reflect.DeepEqual(hitIDs(hits), []string{"hr2", "hr1"}) {
+		t.Fatalf("hits = %+v", hits)
+	}
+	// idf = ln(1 + 1.5/2.5) = ln 1.6, and the repeated word outweighs the equally long title's single one
+	want := []float64{bm25(3, 2, 2, 3, average), bm25(3, 2, 1, 3, average)}
+	for i, w := range want {
+		if math.Abs(hits[i].Score-w) > 1e-9 {
+			t.Errorf("%s scored %v, want %v", hits[i].BillID, hits[i].Score, w)
+		}
+	}
+	if math.Abs(want[0]-1.8729201) > 1e-6 || math.Abs(want[1]-1.3414158) > 1e-6 {
+		t.Errorf("reference scores = %v", want)
+	}
+
+	// any term matches, and scores sum over terms; a shorter title saturates less
+	hits = search(t, store, "water act", 116)
+	if !reflect.DeepEqual(hitIDs(hits), []string{"hr1", "hr2", "hr3"}) {
+		t.Fatalf("hits = %+v", hits)
+	}
+	for i, w := range []float64{2 * bm25(3, 2, 1, 3, average), bm25(3, 2, 2, 3, average), bm25(3, 2, 1, 2, average)} {
+		if math.Abs(hits[i].Score-w) > 1e-9 {
+			t.Errorf("%s scored %v, want %v", hits[i].BillID, hits[i].Score, w)
+		}
+	}
+
+	if ids := hitIDs(search(t, store, "act -energy", 116)); !reflect.DeepEqual(ids, []string{"hr1"}) {
+		t.Errorf("exclusion hits = %v", ids)
+	}
+	if ids := hitIDs(search(t, store, "nuclear", 116)); len(ids) != 0 {
+		t.Errorf("unknown term hits = %v", ids)
+	}
+	if ids := hitIDs(search(t, store, "water", 115)); len(ids) != 0 {
+		t.Errorf("unindexed congress hits = %v", ids)
+	}
+}
+
+func TestFieldWeights(t *testing.T) {
+	store := database.NewMemory()
+	index(t, store, 116,
+		database.Bill{ID: "hr1", Title: "Tax", Subjects: []string{"Energy"}, Summary: "Health"},
+		database.Bill{ID: "hr2", Title: "Energy", Subjects: []string{"Tax"}, Summary: "Health"},
+		database.Bill{ID: "hr3", Title: "Energy", Subjects: []string{"Health"}, Summary: "Tax"},
+	)
+	hits := search(t, store, "tax", 116)
+	if !reflect.DeepEqual(hitIDs(hits), []string{"hr1", "hr2", "hr3"}) {
+		t.Fatalf("hits = %+v", hits)
+	}
+	// every field holds a single word, so the scores differ only by field weight
+	if r := hits[0].Score / hits[2].Score; math.Abs(r-3) > 1e-9 {
+		t.Errorf("title to summary ratio = %v", r)
+	}
+	if r := hits[1].Score / hits[2].Score; math.Abs(r-2) > 1e-9 {
+		t.Errorf("subjects to summary ratio = %v", r)
+	}
+}
+
+func TestPhrases(t *testing.T) {
+	store := database.NewMemory()
+	index(t, store, 115,
+		database.Bill{ID: "hr1", Title: "Clean water act"},
+		database.Bill{ID: "hr2", Title: "Water clean-up"},
+		database.Bill{ID: "hr3", Title: "Clean and water"},
+		database.Bill{ID: "hr4", Title: "Other", Subjects: []string{"Clean", "Water"}},
+		database.Bill{ID: "hr5", Title: "Other", Subjects: []string{"Clean water"}, Summary: "Water act"},
+	)
+	index(t, store, 116, database.Bill{ID: "hr1", Title: "More clean water"})
+	for _, test := range []struct {
+		search string
+		want   []string
+	}{
+		{`"clean water"`, []string{"hr1", "hr5"}},
+		{`"water clean"`, []string{"hr2"}},
+		// dropped stopwords hold their place on both sides
+		{`"clean and water"`, []string{"hr3"}},
+		{`"clean or water"`, []string{"hr3"}},
+		// every phrase must match, though in any field
+		{`"clean water" "water act"`, []string{"hr1", "hr5"}},
+		{`"clean water" "act"`, []string{"hr1", "hr5"}},
+		{`"clean water" -act`, []string{}},
+		{`"water clean" clean`, []string{"hr2"}},
+	} {
+		if ids := hitIDs(search(t, store, test.search, 115)); !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("%s hits = %v, want %v", test.search, ids, test.want)
+		}
+	}
+
+	hits := search(t, store, `"clean water"`, 115, 116)
+	if len(hits) != 3 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if hits[0].Score < hits[1].Score || hits[1].Score < hits[2].Score {
+		t.Errorf("hits out of order: %+v", hits)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filter := Filter([]Hit{{Congress: 116, BillID: "hr2"}, {Congress: 115, BillID: "s1"}, {Congress: 116, BillID: "hr1"}})
+	want := bson.M{"$or": []bson.M{
+		{"congress": 115, "id": bson.M{"$in": []string{"s1"}}},
+		{"congress": 116, "id": bson.M{"$in": []string{"hr2", "hr1"}}},
+	}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter = %v", filter)
+	}
+
+	store := database.NewMemory()
+	for _, b := range []database.Bill{{Congress: 116, ID: "hr1", Type: "hr", Number: 1}, {Congress: 115, ID: "hr1", Type: "hr", Number: 1}} {
+		b := b
+		if err := store.UpsertBill(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bills, err := store.GetBills(Filter(nil)); err != nil || len(bills) != 0 {
+		t.Errorf("empty filter matched %d bills: %v", len(bills), err)
+	}
+	if bills, err := store.GetBills(filter); err != nil || len(bills) != 1 || bills[0].Congress != 116 {
+		t.Errorf("filter matched %+v: %v", bills, err)
+	}
+}
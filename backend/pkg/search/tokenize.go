@@ -0,0 +1,98 @@
+// Package search indexes and queries the text of bills
+package search
+
+import (
+	"backend/internal/database"
+	"strings"
+	"unicode"
+
+	porterstemmer "github.com/blevesearch/go-porterstemmer"
+)
+
+// Token is a stemmed word of a text
+// Position counts every word of the text, stopwords included, so phrases keep their spacing
+// Start and End are the byte offsets of the word in the text
+type Token struct {
+	Term     string
+	Position int
+	Start    int
+	End      int
+}
+
+// subjectGap separates the positions of consecutive subjects so phrases never span two of them
+const subjectGap = 10
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a about above after again against all am an and any are as at be because been
+		before being below between both but by can did do does doing down during each few for from further had has
+		have having he her here hers herself him himself his how i if in into is it its itself just me more most my
+		myself no nor not now of off on once only or other our ours ourselves out over own s same she should so some
+		such t than that the their theirs them themselves then there these they this those through to too under until
+		up very was we were what when where which while who whom why will with you your yours yourself yourselves`) {
+		stopwords[w] = true
+	}
+}
+
+// stem lowercases and stems a word, leaving numbers as they are
+func stem(word string) string {
+	word = strings.ToLower(word)
+	for _, r := range word {
+		if unicode.IsDigit(r) {
+			return word
+		}
+	}
+	return porterstemmer.StemString(word)
+}
+
+// Tokenize splits text into stemmed words, dropping stopwords
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	position := 0
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := strings.ToLower(text[start:end])
+		if !stopwords[word] {
+			tokens = append(tokens, Token{Term: stem(word), Position: position, Start: start, End: end})
+		}
+		position++
+		start = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// Document returns the tokens of each searchable field of a bill
+// Subject positions continue from one subject to the next, separated by subjectGap
+func Document(b database.Bill) map[string][]Token {
+	subjects := []Token{}
+	offset := 0
+	for _, subject := range b.Subjects {
+		tokens := Tokenize(subject)
+		for _, t := range tokens {
+			t.Position += offset
+			subjects = append(subjects, t)
+		}
+		if n := len(tokens); n > 0 {
+			offset = tokens[n-1].Position + offset + subjectGap
+		}
+	}
+	return map[string][]Token{
+		database.FieldTitle:    Tokenize(b.Title),
+		database.FieldSummary:  Tokenize(b.Summary),
+		database.FieldSubjects: subjects,
+	}
+}
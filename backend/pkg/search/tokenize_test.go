@@ -0,0 +1,63 @@
+package search
+
+import (
+	"backend/internal/database"
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	for word, want := range map[string]string{
+		"connections": "connect",
+		"Running":     "run",
+		"policies":    "polici",
+		"energy":      "energi",
+		"waters":      "water",
+		"amended":     "amend",
+		"2019":        "2019",
+		"H1N1":        "h1n1",
+	} {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The Clean-Water Act of 2019, amended")
+	// stopwords are dropped but still take a position
+	want := []Token{
+		{Term: "clean", Position: 1, Start: 4, End: 9},
+		{Term: "water", Position: 2, Start: 10, End: 15},
+		{Term: "act", Position: 3, Start: 16, End: 19},
+		{Term: "2019", Position: 5, Start: 23, End: 27},
+		{Term: "amend", Position: 6, Start: 29, End: 36},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens = %+v", got)
+	}
+
+	// offsets are in bytes
+	got = Tokenize("Café naïve")
+	if len(got) != 2 || got[0].End != 5 || got[1].Start != 6 || got[1].End != 12 {
+		t.Errorf("tokens = %+v", got)
+	}
+	if got := Tokenize(" -- the of "); len(got) != 0 {
+		t.Errorf("tokens = %+v", got)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	doc := Document(database.Bill{Title: "Clean Air", Summary: "", Subjects: []string{"Clean Water", "Air", "The"}})
+	if len(doc[database.FieldTitle]) != 2 || len(doc[database.FieldSummary]) != 0 {
+		t.Errorf("document = %+v", doc)
+	}
+	// each subject starts subjectGap positions after the last word of the one before
+	positions := []int{}
+	for _, token := range doc[database.FieldSubjects] {
+		positions = append(positions, token.Position)
+	}
+	if !reflect.DeepEqual(positions, []int{0, 1, 1 + subjectGap}) {
+		t.Errorf("subject positions = %v", positions)
+	}
+}
@@ -1,5 +1,10 @@
 package utility
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Contains checks a string slice for membership
 func Contains(ss []string, s string) bool {
 	for _, m := range ss {
@@ -9,3 +14,31 @@ func Contains(ss []string, s string) bool {
 	}
 	return false
 }
+
+// Ordinal formats a number with its English ordinal suffix (e.g. 116th, 101st)
+func Ordinal(n int) string {
+	suffix := "th"
+	switch n % 100 {
+	case 11, 12, 13:
+	default:
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// Keys returns the sorted members of a string set
+func Keys(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
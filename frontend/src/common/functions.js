@@ -36,3 +36,11 @@ export function truncate(s, len) {
 export function sleep(ms) {
   return new Promise(resolve => setTimeout(resolve, ms))
 }
+
+export function sponsorNames(bill) {
+  return bill.sponsors.map(s => s.name)
+}
+
+export function activeCosponsors(bill) {
+  return bill.cosponsors.filter(c => !c.withdrawnDate).map(c => c.name)
+}
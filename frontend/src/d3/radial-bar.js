@@ -2,7 +2,6 @@ import * as d3 from 'd3'
 
 export function transform(member, memberMap, threshold) {
   return Object.keys(member.counts)
-    .map(id => +id)
     .map(id => ({ ...memberMap[id], count: member.counts[id] }))
     .filter(m => m.count >= threshold)
     .map((m, i) => ({ ...m, index: i }))
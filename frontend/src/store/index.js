@@ -8,6 +8,21 @@ const api = axios.create({
   baseURL: `${window.location.origin}/api/`,
 })
 
+// getAllBills follows the bill listing's cursor, returning every page's bills
+const getAllBills = async (params, config = {}) => {
+  const bills = []
+  let cursor
+  do {
+    const response = await api.get('bills', {
+      ...config,
+      params: { ...params, limit: 1000, cursor },
+    })
+    bills.push(...response.data.bills)
+    cursor = response.data.nextCursor
+  } while (cursor)
+  return bills
+}
+
 Vue.use(Vuex)
 
 export default new Vuex.Store({
@@ -79,10 +94,7 @@ export default new Vuex.Store({
 
     async getBillsByNumbers(_, billNumbers) {
       try {
-        const response = await api.get('bills/number', {
-          params: { billNumbers },
-        })
-        return response.data
+        return await getAllBills({ billNumbers })
       } catch (err) {
         console.error(err)
       }
@@ -96,11 +108,8 @@ export default new Vuex.Store({
       const source = axios.CancelToken.source()
 
       try {
-        const response = await api.get('bills/title', {
-          params,
-          cancelToken: source.token,
-        })
-        return { bills: response.data, source }
+        const bills = await getAllBills(params, { cancelToken: source.token })
+        return { bills, source }
       } catch (err) {
         console.error(err)
       }
@@ -114,11 +123,8 @@ export default new Vuex.Store({
       const source = axios.CancelToken.source()
 
       try {
-        const response = await api.get('bills/subject', {
-          params,
-          cancelToken: source.token,
-        })
-        return { bills: response.data, source }
+        const bills = await getAllBills(params, { cancelToken: source.token })
+        return { bills, source }
       } catch (err) {
         console.error(err)
       }